@@ -0,0 +1,126 @@
+// Command ratelimit-replay replays access logs against rate limiting
+// policies using simulated time, so days of traffic replay in seconds.
+//
+//	ratelimit-replay -policy fixed=fixed_window:100/1m -policy bucket=token_bucket:100/1m access.log
+//
+// Logs may be in Common or Combined Log Format or JSON lines, and are read
+// from stdin when no files are given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/replay"
+)
+
+type policyFlags []replay.Policy
+
+func (p *policyFlags) String() string {
+	names := make([]string, len(*p))
+	for i, policy := range *p {
+		names[i] = policy.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (p *policyFlags) Set(spec string) error {
+	policy, err := replay.ParsePolicy(spec)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, policy)
+	return nil
+}
+
+func main() {
+	var policies policyFlags
+	parser := &replay.Parser{}
+	flag.Var(&policies, "policy", "policy as name=strategy:limit/window, repeatable")
+	flag.StringVar(&parser.TimeField, "time-field", "time", "timestamp field of JSON logs")
+	flag.StringVar(&parser.KeyField, "key-field", "remote_addr", "key field of JSON logs")
+	top := flag.Int("top", 10, "number of keys to list per policy")
+	flag.Parse()
+
+	if len(policies) == 0 {
+		fmt.Fprintln(os.Stderr, "ratelimit-replay: at least one -policy is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	entries, skipped, err := readEntries(parser, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimit-replay:", err)
+		os.Exit(1)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "ratelimit-replay: skipped %d unparsable lines\n", skipped)
+	}
+
+	printReport(os.Stdout, replay.Run(entries, policies, *top))
+}
+
+func readEntries(parser *replay.Parser, paths []string) ([]replay.Entry, int, error) {
+	if len(paths) == 0 {
+		return parser.ReadAll(os.Stdin)
+	}
+
+	var entries []replay.Entry
+	skipped := 0
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		read, n, err := parser.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, read...)
+		skipped += n
+	}
+	return entries, skipped, nil
+}
+
+func printReport(out io.Writer, report replay.Report) {
+	fmt.Fprintf(out, "%d requests\n\n", report.Requests)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POLICY\tSTRATEGY\tLIMIT\tWINDOW\tALLOWED\tREJECTED\tREJECTED %")
+	for _, result := range report.Results {
+		rate := 0.0
+		if report.Requests > 0 {
+			rate = float64(result.Rejected) / float64(report.Requests) * 100
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t%.2f\n", result.Policy.Name, result.Policy.Strategy,
+			result.Policy.Limit, result.Policy.WindowSize, result.Allowed, result.Rejected, rate)
+	}
+	w.Flush()
+
+	for _, result := range report.Results {
+		fmt.Fprintf(out, "\nmost throttled keys for %s:\n", result.Policy.Name)
+		printKeys(out, result.Throttled)
+	}
+
+	if len(report.Results) > 1 {
+		fmt.Fprintf(out, "\npolicies disagreed on %d requests:\n", report.Disagreements)
+		printKeys(out, report.DisagreementKeys)
+	}
+}
+
+func printKeys(out io.Writer, keys []replay.KeyCount) {
+	if len(keys) == 0 {
+		fmt.Fprintln(out, "  none")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%d\n", key.Key, key.Count)
+	}
+	w.Flush()
+}
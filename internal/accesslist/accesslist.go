@@ -0,0 +1,187 @@
+package accesslist
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+type Action int
+
+const (
+	NoMatch Action = iota
+	Allow
+	Deny
+)
+
+// List holds allow and deny rules. A rule is an exact identifier, an IPv4 or
+// IPv6 address or CIDR range, or a path.Match pattern such as "partner-*".
+// Deny rules win when an identifier matches both lists.
+type List struct {
+	rules atomic.Pointer[ruleSet]
+}
+
+type ruleSet struct {
+	allow *matcher
+	deny  *matcher
+}
+
+func New(allow, deny []string) (*List, error) {
+	l := &List{}
+	if err := l.Reload(allow, deny); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload replaces all rules at once. Lookups running concurrently see either
+// the old or the new rules, never a mix.
+func (l *List) Reload(allow, deny []string) error {
+	allowMatcher, err := newMatcher(allow)
+	if err != nil {
+		return fmt.Errorf("allow list: %w", err)
+	}
+	denyMatcher, err := newMatcher(deny)
+	if err != nil {
+		return fmt.Errorf("deny list: %w", err)
+	}
+
+	l.rules.Store(&ruleSet{allow: allowMatcher, deny: denyMatcher})
+	return nil
+}
+
+func (l *List) Match(identifier string) Action {
+	rules := l.rules.Load()
+	if rules == nil {
+		return NoMatch
+	}
+
+	addr, err := netip.ParseAddr(identifier)
+	isAddr := err == nil
+	if isAddr {
+		addr = addr.Unmap()
+	}
+
+	if rules.deny.match(identifier, addr, isAddr) {
+		return Deny
+	}
+	if rules.allow.match(identifier, addr, isAddr) {
+		return Allow
+	}
+	return NoMatch
+}
+
+type matcher struct {
+	exact    map[string]struct{}
+	v4       *trieNode
+	v6       *trieNode
+	patterns []string
+}
+
+func newMatcher(rules []string) (*matcher, error) {
+	m := &matcher{exact: map[string]struct{}{}, v4: &trieNode{}, v6: &trieNode{}}
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(rule); err == nil {
+			m.insert(prefix)
+		} else if addr, err := netip.ParseAddr(rule); err == nil {
+			addr = addr.Unmap()
+			m.insert(netip.PrefixFrom(addr, addr.BitLen()))
+		} else if strings.ContainsAny(rule, "*?[") {
+			if _, err := path.Match(rule, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", rule, err)
+			}
+			m.patterns = append(m.patterns, rule)
+		} else if strings.Contains(rule, "/") {
+			return nil, fmt.Errorf("invalid CIDR range %q", rule)
+		} else {
+			m.exact[rule] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+func (m *matcher) insert(prefix netip.Prefix) {
+	addr := prefix.Addr().Unmap()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		bits = max(bits-96, 0)
+	}
+
+	root := m.v6
+	if addr.Is4() {
+		root = m.v4
+	}
+	root.insert(addr.AsSlice(), bits)
+}
+
+func (m *matcher) match(identifier string, addr netip.Addr, isAddr bool) bool {
+	if _, exists := m.exact[identifier]; exists {
+		return true
+	}
+
+	if isAddr {
+		root := m.v6
+		if addr.Is4() {
+			root = m.v4
+		}
+		if root.contains(addr.AsSlice()) {
+			return true
+		}
+	}
+
+	for _, pattern := range m.patterns {
+		if matched, _ := path.Match(pattern, identifier); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// trieNode is a binary trie over address bits. A terminal node covers every
+// address below it, so a lookup stops at the first terminal node it reaches.
+type trieNode struct {
+	children [2]*trieNode
+	terminal bool
+}
+
+func (n *trieNode) insert(addr []byte, bits int) {
+	node := n
+	for i := 0; i < bits; i++ {
+		if node.terminal {
+			return
+		}
+		bit := bitAt(addr, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode{}
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+	node.children = [2]*trieNode{}
+}
+
+func (n *trieNode) contains(addr []byte) bool {
+	node := n
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == len(addr)*8 {
+			return false
+		}
+		node = node.children[bitAt(addr, i)]
+	}
+	return false
+}
+
+func bitAt(addr []byte, i int) int {
+	return int(addr[i/8]>>(7-i%8)) & 1
+}
@@ -0,0 +1,99 @@
+package accesslist
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	list, err := New(
+		[]string{"10.0.0.0/8", "2001:db8::/32", "monitoring", "partner-*", "192.168.1.7"},
+		[]string{"10.6.6.0/24", "bad-*"},
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	cases := []struct {
+		identifier string
+		want       Action
+	}{
+		{"10.1.2.3", Allow},
+		{"10.6.6.6", Deny},
+		{"11.0.0.1", NoMatch},
+		{"192.168.1.7", Allow},
+		{"192.168.1.8", NoMatch},
+		{"::ffff:10.1.2.3", Allow},
+		{"2001:db8::1", Allow},
+		{"2001:db9::1", NoMatch},
+		{"monitoring", Allow},
+		{"partner-acme", Allow},
+		{"bad-actor", Deny},
+		{"ege", NoMatch},
+	}
+
+	for _, c := range cases {
+		if got := list.Match(c.identifier); got != c.want {
+			t.Errorf("Match(%q) got %d want %d", c.identifier, got, c.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	list, _ := New(nil, []string{"10.0.0.0/8"})
+
+	if list.Match("10.0.0.1") != Deny {
+		t.Fatal("expected 10.0.0.1 to be denied")
+	}
+
+	if err := list.Reload([]string{"10.0.0.0/8"}, nil); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if list.Match("10.0.0.1") != Allow {
+		t.Error("expected 10.0.0.1 to be allowed after reload")
+	}
+}
+
+func TestReloadKeepsRulesOnError(t *testing.T) {
+	list, _ := New([]string{"monitoring"}, nil)
+
+	if err := list.Reload([]string{"10.0.0.0/99"}, nil); err == nil {
+		t.Fatal("expected an error for an invalid range")
+	}
+
+	if list.Match("monitoring") != Allow {
+		t.Error("failed reload should keep the previous rules")
+	}
+}
+
+func TestManyRanges(t *testing.T) {
+	var deny []string
+	for i := range 50000 {
+		deny = append(deny, fmt.Sprintf("10.%d.%d.0/24", i/256%256, i%256))
+	}
+	list, err := New(nil, deny)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if list.Match("10.100.200.1") != Deny {
+		t.Error("expected address in a listed range to be denied")
+	}
+	if list.Match("11.100.200.1") != NoMatch {
+		t.Error("expected address outside every range not to match")
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	var deny []string
+	for i := range 50000 {
+		deny = append(deny, fmt.Sprintf("10.%d.%d.0/24", i/256%256, i%256))
+	}
+	list, _ := New(nil, deny)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		list.Match("10.100.200.1")
+	}
+}
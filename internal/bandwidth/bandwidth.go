@@ -0,0 +1,140 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+// Limiter hands out per-identifier byte budgets from a shared token bucket,
+// so every stream opened for the same identifier draws from the same budget.
+type Limiter struct {
+	bucket    *strategies.TokenBucketStrategy
+	chunkSize int
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// NewLimiter allows bytesPerSecond bytes per identifier. Transfers are split
+// into chunks of a tenth of that so they are paced instead of sent in bursts.
+func NewLimiter(bytesPerSecond int, timeProvider strategies.TimeProvider) *Limiter {
+	return &Limiter{
+		bucket:    strategies.NewTokenBucketStrategy(bytesPerSecond, time.Second, timeProvider),
+		chunkSize: max(bytesPerSecond/10, 1),
+		sleep:     sleeper(clock.From(timeProvider)),
+	}
+}
+
+func (l *Limiter) WaitN(ctx context.Context, identifier string, n int) error {
+	delay := l.bucket.Reserve(identifier, n)
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := l.sleep(ctx, delay); err != nil {
+		l.bucket.Release(identifier, n)
+		return err
+	}
+	return nil
+}
+
+func (l *Limiter) NewReader(ctx context.Context, identifier string, r io.Reader) io.Reader {
+	return &reader{ctx: ctx, limiter: l, identifier: identifier, r: r}
+}
+
+func (l *Limiter) NewWriter(ctx context.Context, identifier string, w io.Writer) io.Writer {
+	return &writer{ctx: ctx, limiter: l, identifier: identifier, w: w}
+}
+
+func (l *Limiter) NewReadCloser(ctx context.Context, identifier string, rc io.ReadCloser) io.ReadCloser {
+	return &readCloser{Reader: l.NewReader(ctx, identifier, rc), Closer: rc}
+}
+
+func (l *Limiter) NewResponseWriter(ctx context.Context, identifier string, w http.ResponseWriter) http.ResponseWriter {
+	return &responseWriter{ResponseWriter: w, writer: writer{ctx: ctx, limiter: l, identifier: identifier, w: w}}
+}
+
+func (l *Limiter) Stop() {
+	l.bucket.Stop()
+}
+
+type reader struct {
+	ctx        context.Context
+	limiter    *Limiter
+	identifier string
+	r          io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.chunkSize {
+		p = p[:r.limiter.chunkSize]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, r.identifier, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type writer struct {
+	ctx        context.Context
+	limiter    *Limiter
+	identifier string
+	w          io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.limiter.chunkSize)]
+		if err := w.limiter.WaitN(w.ctx, w.identifier, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	writer writer
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func sleeper(c clock.Clock) func(ctx context.Context, d time.Duration) error {
+	return func(ctx context.Context, d time.Duration) error {
+		timer := c.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
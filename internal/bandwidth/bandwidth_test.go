@@ -0,0 +1,162 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type MockTimeProvider struct {
+	currentTime time.Time
+}
+
+func (m *MockTimeProvider) Now() time.Time {
+	return m.currentTime
+}
+
+func (m *MockTimeProvider) Advance(duration time.Duration) {
+	m.currentTime = m.currentTime.Add(duration)
+}
+
+func newTestLimiter(bytesPerSecond int) (*Limiter, *[]time.Duration) {
+	mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(bytesPerSecond, mockTimeProvider)
+
+	sleeps := &[]time.Duration{}
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		*sleeps = append(*sleeps, d)
+		mockTimeProvider.Advance(d)
+		return nil
+	}
+	return limiter, sleeps
+}
+
+func total(sleeps []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range sleeps {
+		sum += d
+	}
+	return sum
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("writes within the budget do not wait", func(t *testing.T) {
+		limiter, sleeps := newTestLimiter(100)
+		defer limiter.Stop()
+
+		var buf bytes.Buffer
+		n, err := limiter.NewWriter(context.Background(), "ege", &buf).Write(make([]byte, 100))
+
+		if n != 100 || err != nil {
+			t.Errorf("expected 100 bytes written got %d %v", n, err)
+		}
+		if len(*sleeps) != 0 {
+			t.Errorf("expected no waiting got %v", *sleeps)
+		}
+	})
+
+	t.Run("writes over the budget are paced in small steps", func(t *testing.T) {
+		limiter, sleeps := newTestLimiter(100)
+		defer limiter.Stop()
+
+		var buf bytes.Buffer
+		n, err := limiter.NewWriter(context.Background(), "ege", &buf).Write(make([]byte, 300))
+
+		if n != 300 || err != nil {
+			t.Errorf("expected 300 bytes written got %d %v", n, err)
+		}
+		if total(*sleeps) != 2*time.Second {
+			t.Errorf("expected 2s of waiting got %v", total(*sleeps))
+		}
+		for _, d := range *sleeps {
+			if d > 100*time.Millisecond {
+				t.Errorf("expected paced waits of at most 100ms got %v", d)
+			}
+		}
+	})
+
+	t.Run("streams of the same identifier share the budget", func(t *testing.T) {
+		limiter, sleeps := newTestLimiter(100)
+		defer limiter.Stop()
+
+		var buf bytes.Buffer
+		limiter.NewWriter(context.Background(), "ege", &buf).Write(make([]byte, 100))
+		limiter.NewWriter(context.Background(), "other", &buf).Write(make([]byte, 100))
+
+		if len(*sleeps) != 0 {
+			t.Errorf("different identifiers should not wait got %v", *sleeps)
+		}
+
+		limiter.NewWriter(context.Background(), "ege", &buf).Write(make([]byte, 50))
+
+		if total(*sleeps) != 500*time.Millisecond {
+			t.Errorf("expected 500ms of waiting got %v", total(*sleeps))
+		}
+	})
+
+	t.Run("cancelled context stops the write", func(t *testing.T) {
+		limiter, _ := newTestLimiter(100)
+		defer limiter.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var buf bytes.Buffer
+		n, err := limiter.NewWriter(ctx, "ege", &buf).Write(make([]byte, 300))
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled got %v", err)
+		}
+		if n != 100 {
+			t.Errorf("expected the budgeted 100 bytes to be written got %d", n)
+		}
+	})
+}
+
+func TestReader(t *testing.T) {
+	limiter, sleeps := newTestLimiter(100)
+	defer limiter.Stop()
+
+	r := limiter.NewReader(context.Background(), "ege", strings.NewReader(strings.Repeat("a", 200)))
+	data, err := io.ReadAll(r)
+
+	if err != nil || len(data) != 200 {
+		t.Errorf("expected 200 bytes read got %d %v", len(data), err)
+	}
+	if total(*sleeps) != time.Second {
+		t.Errorf("expected 1s of waiting got %v", total(*sleeps))
+	}
+}
+
+func TestWaitNOnFakeClock(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(100, fakeClock)
+	defer limiter.Stop()
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.WaitN(context.Background(), "ege", 200)
+	}()
+
+	// The bucket's cleanup ticker and the wait timer.
+	fakeClock.BlockUntil(2)
+	select {
+	case <-done:
+		t.Fatal("wait should block until the clock advances")
+	default:
+	}
+
+	fakeClock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type MockTimeProvider struct {
+	currentTime time.Time
+}
+
+func (m *MockTimeProvider) Now() time.Time {
+	return m.currentTime
+}
+
+// startCluster runs n nodes on loopback, each allowing limit requests per
+// minute for the keys it owns.
+func startCluster(t *testing.T, n, limit int) []*Node {
+	t.Helper()
+	tp := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	muxes := make([]*http.ServeMux, n)
+	peers := make([]string, n)
+	for i := range n {
+		muxes[i] = http.NewServeMux()
+		server := httptest.NewServer(muxes[i])
+		t.Cleanup(server.Close)
+		peers[i] = server.URL
+	}
+
+	nodes := make([]*Node, n)
+	for i := range n {
+		nodes[i] = NewNode(Config{
+			Self:  peers[i],
+			Peers: peers,
+			Local: strategies.NewFixedWindowStrategy(limit, time.Minute, tp),
+		})
+		muxes[i].Handle(PathPrefix, nodes[i].Handler())
+		t.Cleanup(nodes[i].Stop)
+	}
+	return nodes
+}
+
+func TestRing(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+
+	t.Run("keys are spread over all peers", func(t *testing.T) {
+		ring := NewRing(0, "a", "b", "c")
+		owned := map[string]int{}
+		for _, key := range keys {
+			owned[ring.Owner(key)]++
+		}
+
+		for _, peer := range []string{"a", "b", "c"} {
+			if owned[peer] < 200 {
+				t.Errorf("expected peer %s to own a fair share of 1000 keys got %d", peer, owned[peer])
+			}
+		}
+	})
+
+	t.Run("adding a peer only moves keys to it", func(t *testing.T) {
+		before := NewRing(0, "a", "b", "c")
+		after := NewRing(0, "a", "b", "c", "d")
+
+		for _, key := range keys {
+			if owner := after.Owner(key); owner != before.Owner(key) && owner != "d" {
+				t.Errorf("key %s moved from %s to %s", key, before.Owner(key), owner)
+			}
+		}
+	})
+
+	t.Run("empty ring", func(t *testing.T) {
+		if owner := NewRing(0).Owner("ege"); owner != "" {
+			t.Errorf("expected no owner got %q", owner)
+		}
+	})
+}
+
+func TestCluster(t *testing.T) {
+	t.Run("every node enforces the owner's limit", func(t *testing.T) {
+		nodes := startCluster(t, 3, 5)
+
+		allowed := 0
+		for i := range 12 {
+			if ok, _ := nodes[i%3].IsRequestAllowed("ege"); ok {
+				allowed++
+			}
+		}
+		if allowed != 5 {
+			t.Errorf("expected the cluster to allow 5 requests for one key got %d", allowed)
+		}
+
+		for _, node := range nodes {
+			if ok, remaining := node.Peek("ege"); ok || remaining != 0 {
+				t.Errorf("expected every node to see the key exhausted got %v, %d", ok, remaining)
+			}
+		}
+	})
+
+	t.Run("reset and grant reach the owner", func(t *testing.T) {
+		nodes := startCluster(t, 3, 1)
+		owner := nodes[0].Owner("ege")
+		var other *Node
+		for _, node := range nodes {
+			if node.self != owner {
+				other = node
+			}
+		}
+
+		other.IsRequestAllowed("ege")
+		other.Grant("ege", 1)
+		if ok, _ := other.IsRequestAllowed("ege"); !ok {
+			t.Error("expected the grant to allow another request")
+		}
+
+		other.Reset("ege")
+		if ok, _ := other.IsRequestAllowed("ege"); !ok {
+			t.Error("expected the reset to clear the owner's count")
+		}
+	})
+
+	t.Run("ownership rebalances when a peer leaves and joins", func(t *testing.T) {
+		nodes := startCluster(t, 3, 1)
+		owner := nodes[0].Owner("ege")
+
+		var remaining []*Node
+		for _, node := range nodes {
+			if node.self != owner {
+				node.RemovePeer(owner)
+				remaining = append(remaining, node)
+			}
+		}
+		newOwner := remaining[0].Owner("ege")
+		if newOwner == owner || remaining[1].Owner("ege") != newOwner {
+			t.Fatalf("expected the remaining peers to agree on a new owner got %s and %s", newOwner, remaining[1].Owner("ege"))
+		}
+		if ok, _ := remaining[0].IsRequestAllowed("ege"); !ok {
+			t.Error("expected the new owner to start the key over")
+		}
+
+		for _, node := range remaining {
+			node.AddPeer(owner)
+		}
+		for _, node := range nodes {
+			if node.Owner("ege") != owner {
+				t.Errorf("expected %s to own the key again after rejoining got %s", owner, node.Owner("ege"))
+			}
+		}
+	})
+
+	t.Run("unreachable owners fail open to the local strategy", func(t *testing.T) {
+		self := httptest.NewServer(http.NotFoundHandler())
+		defer self.Close()
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		node := NewNode(Config{
+			Self:  self.URL,
+			Peers: []string{down.URL},
+			Local: strategies.NewFixedWindowStrategy(1, time.Minute, &MockTimeProvider{}),
+		})
+		defer node.Stop()
+
+		key := ownedBy(node, down.URL)
+		decision, err := node.Allow(context.Background(), key)
+		if err != nil || !decision.Allowed || !decision.Degraded {
+			t.Errorf("expected a degraded local decision got %+v, %v", decision, err)
+		}
+		if ok, _ := node.IsRequestAllowed(key); ok {
+			t.Error("expected the local limit to apply without an answer from the owner")
+		}
+	})
+
+	t.Run("hung owners time out", func(t *testing.T) {
+		self := httptest.NewServer(http.NotFoundHandler())
+		defer self.Close()
+		release := make(chan struct{})
+		hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer hung.Close()
+		defer close(release)
+
+		node := NewNode(Config{
+			Self:    self.URL,
+			Peers:   []string{hung.URL},
+			Local:   strategies.NewFixedWindowStrategy(1, time.Minute, &MockTimeProvider{}),
+			Timeout: 20 * time.Millisecond,
+		})
+		defer node.Stop()
+
+		key := ownedBy(node, hung.URL)
+		done := make(chan struct{})
+		go func() {
+			node.Refund(key, 1)
+			node.Allow(context.Background(), key)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected forwarded calls to give up after the timeout")
+		}
+	})
+
+	t.Run("nodes back a ratelimiter", func(t *testing.T) {
+		nodes := startCluster(t, 2, 2)
+		limiter := ratelimiter.NewRateLimiterWithStrategy(nodes[0])
+
+		for i := range 3 {
+			decision, err := limiter.Allow(context.Background(), "ege")
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if decision.Allowed != (i < 2) {
+				t.Errorf("request %d: expected allowed %v got %v", i, i < 2, decision.Allowed)
+			}
+		}
+	})
+
+	t.Run("auth hook", func(t *testing.T) {
+		node := NewNode(Config{
+			Self:  "http://127.0.0.1:7946",
+			Local: strategies.NewFixedWindowStrategy(1, time.Minute, &MockTimeProvider{}),
+			Authorize: func(r *http.Request) bool {
+				return r.Header.Get("Authorization") == "Bearer secret"
+			},
+		})
+		defer node.Stop()
+
+		request := func(authorization string) int {
+			req := httptest.NewRequest("POST", PathPrefix+"peek", strings.NewReader(`{"key":"ege"}`))
+			req.Header.Set("Authorization", authorization)
+			rec := httptest.NewRecorder()
+			node.Handler().ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		if code := request(""); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+		if code := request("Bearer secret"); code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", code)
+		}
+	})
+}
+
+// ownedBy finds a key node forwards to owner.
+func ownedBy(node *Node, owner string) string {
+	for i := 0; ; i++ {
+		if key := fmt.Sprintf("user-%d", i); node.Owner(key) == owner {
+			return key
+		}
+	}
+}
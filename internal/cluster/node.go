@@ -0,0 +1,290 @@
+// Package cluster spreads keys over Ratelimiter instances without an external
+// store. Every key is owned by one peer, and the other peers forward its
+// decisions to the owner over HTTP.
+//
+// There is no membership protocol or failure detection: the peer list only
+// changes when SetPeers, AddPeer or RemovePeer is called on every node, and
+// keys that change owner do not take their counts with them. Until a dead
+// peer is removed, its keys fail open to the local strategy of each node.
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+)
+
+// PathPrefix is where Handler serves the peer protocol.
+const PathPrefix = "/cluster/"
+
+type Config struct {
+	// Self is this node's base URL as the other peers know it, for example
+	// "http://10.0.0.1:7946".
+	Self string
+	// Peers is the static peer list. Self is added when missing.
+	Peers []string
+	// Local decides the keys this node owns.
+	Local ratelimiter.RateLimitStrategy
+	// Replicas is how often each peer is placed on the hash ring. Defaults
+	// to 100.
+	Replicas int
+	// Client forwards decisions to owners. Defaults to http.DefaultClient.
+	// Its transport can add the credentials the peers' Authorize expects.
+	Client *http.Client
+	// Timeout bounds every forwarded call. Defaults to one second.
+	Timeout time.Duration
+	// Authorize is consulted before every forwarded request Handler serves,
+	// requests it refuses are answered with 401. All requests are allowed
+	// when it is nil, so the peer endpoints must not be reachable by clients.
+	Authorize func(r *http.Request) bool
+}
+
+type peerRequest struct {
+	Key string `json:"key"`
+	N   int    `json:"n,omitempty"`
+}
+
+type peerResponse struct {
+	Allowed   bool      `json:"allowed"`
+	Remaining int       `json:"remaining"`
+	RetryAt   time.Time `json:"retry_at"`
+}
+
+// Node is a RateLimitStrategy that decides owned keys locally and forwards
+// the rest. State is not moved when ownership changes: a key that moves to
+// another peer starts over there, so a rebalance can admit up to one extra
+// limit for the moved keys. Keys whose owner cannot be reached are decided
+// by the local strategy instead, and the decisions are marked Degraded.
+type Node struct {
+	self     string
+	local    ratelimiter.RateLimitStrategy
+	replicas int
+	client   *http.Client
+	timeout  time.Duration
+
+	authorize func(r *http.Request) bool
+
+	mu   sync.RWMutex
+	ring *Ring
+}
+
+func NewNode(config Config) *Node {
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+
+	n := &Node{
+		self:     config.Self,
+		local:    config.Local,
+		replicas: config.Replicas,
+		client:   client,
+		timeout:  timeout,
+
+		authorize: config.Authorize,
+	}
+	n.SetPeers(config.Peers)
+	return n
+}
+
+// SetPeers replaces the peer list and rebalances ownership.
+func (n *Node) SetPeers(peers []string) {
+	if !slices.Contains(peers, n.self) {
+		peers = append(slices.Clone(peers), n.self)
+	}
+	ring := NewRing(n.replicas, peers...)
+
+	n.mu.Lock()
+	n.ring = ring
+	n.mu.Unlock()
+}
+
+func (n *Node) AddPeer(peer string) {
+	n.SetPeers(append(n.Peers(), peer))
+}
+
+// RemovePeer takes peer out of the ring. Self cannot be removed.
+func (n *Node) RemovePeer(peer string) {
+	n.SetPeers(slices.DeleteFunc(n.Peers(), func(p string) bool { return p == peer }))
+}
+
+func (n *Node) Peers() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ring.Peers()
+}
+
+func (n *Node) Owner(key string) string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ring.Owner(key)
+}
+
+func (n *Node) IsRequestAllowed(identifier string) (bool, int) {
+	decision, _ := n.Allow(context.Background(), identifier)
+	return decision.Allowed, decision.Remaining
+}
+
+func (n *Node) Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error) {
+	owner := n.Owner(identifier)
+	if owner == n.self {
+		return ratelimiter.Adapt(n.local).Allow(ctx, identifier)
+	}
+
+	response, err := n.forward(ctx, owner, "allow", peerRequest{Key: identifier})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ratelimiter.Decision{}, ctx.Err()
+		}
+		decision, err := ratelimiter.Adapt(n.local).Allow(ctx, identifier)
+		decision.Degraded = true
+		return decision, err
+	}
+	return ratelimiter.Decision{Allowed: response.Allowed, Remaining: response.Remaining, Source: ratelimiter.SourceStrategy, RetryAt: response.RetryAt}, nil
+}
+
+func (n *Node) Peek(identifier string) (bool, int) {
+	owner := n.Owner(identifier)
+	if owner == n.self {
+		return n.local.Peek(identifier)
+	}
+
+	response, err := n.forward(context.Background(), owner, "peek", peerRequest{Key: identifier})
+	if err != nil {
+		return n.local.Peek(identifier)
+	}
+	return response.Allowed, response.Remaining
+}
+
+// Reset, Grant and Refund are sent to the owner on a best-effort basis.
+func (n *Node) Reset(identifier string) {
+	owner := n.Owner(identifier)
+	if owner == n.self {
+		n.local.Reset(identifier)
+		return
+	}
+	n.forward(context.Background(), owner, "reset", peerRequest{Key: identifier})
+}
+
+func (n *Node) Grant(identifier string, count int) {
+	owner := n.Owner(identifier)
+	if owner == n.self {
+		n.local.Grant(identifier, count)
+		return
+	}
+	n.forward(context.Background(), owner, "grant", peerRequest{Key: identifier, N: count})
+}
+
+func (n *Node) Refund(identifier string, count int) {
+	owner := n.Owner(identifier)
+	if owner == n.self {
+		n.refundLocal(identifier, count)
+		return
+	}
+	n.forward(context.Background(), owner, "refund", peerRequest{Key: identifier, N: count})
+}
+
+// CanRefund assumes the peers use the same local strategy as this node.
+func (n *Node) CanRefund() bool {
+	return ratelimiter.CanRefund(n.local)
+}
+
+func (n *Node) refundLocal(identifier string, count int) {
+	if refundable, ok := n.local.(ratelimiter.RefundableStrategy); ok {
+		refundable.Refund(identifier, count)
+	}
+}
+
+func (n *Node) Stop() {
+	n.local.Stop()
+}
+
+func (n *Node) forward(ctx context.Context, owner, op string, request peerRequest) (peerResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return peerResponse{}, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, owner+PathPrefix+op, bytes.NewReader(body))
+	if err != nil {
+		return peerResponse{}, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := n.client.Do(httpRequest)
+	if err != nil {
+		return peerResponse{}, fmt.Errorf("forwarding to %s: %w", owner, err)
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		return peerResponse{}, fmt.Errorf("forwarding to %s: unexpected status %d", owner, httpResponse.StatusCode)
+	}
+
+	var response peerResponse
+	if err := json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return peerResponse{}, fmt.Errorf("forwarding to %s: %w", owner, err)
+	}
+	return response, nil
+}
+
+// Handler serves decisions forwarded by other peers. They are always decided
+// locally, even if this node's ring disagrees during a rebalance, so requests
+// never bounce between peers.
+func (n *Node) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+PathPrefix+"{op}", n.serve)
+	return mux
+}
+
+func (n *Node) serve(w http.ResponseWriter, r *http.Request) {
+	if n.authorize != nil && !n.authorize(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request peerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Key == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var response peerResponse
+	switch r.PathValue("op") {
+	case "allow":
+		decision, err := ratelimiter.Adapt(n.local).Allow(r.Context(), request.Key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		response = peerResponse{Allowed: decision.Allowed, Remaining: decision.Remaining, RetryAt: decision.RetryAt}
+	case "peek":
+		response.Allowed, response.Remaining = n.local.Peek(request.Key)
+	case "reset":
+		n.local.Reset(request.Key)
+	case "grant":
+		n.local.Grant(request.Key, request.N)
+	case "refund":
+		n.refundLocal(request.Key, request.N)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+)
+
+const defaultReplicas = 100
+
+// Ring assigns keys to peers by consistent hashing, so adding or removing a
+// peer only moves the keys that peer gains or loses.
+type Ring struct {
+	hashes []uint64
+	owners map[uint64]string
+	peers  []string
+}
+
+// NewRing places every peer on the ring replicas times. Duplicate peers are
+// ignored.
+func NewRing(replicas int, peers ...string) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+
+	r := &Ring{owners: map[uint64]string{}}
+	for _, peer := range peers {
+		if slices.Contains(r.peers, peer) {
+			continue
+		}
+		r.peers = append(r.peers, peer)
+		for i := range replicas {
+			hash := hashKey(peer + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[hash]; taken {
+				continue
+			}
+			r.owners[hash] = peer
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	slices.Sort(r.hashes)
+	slices.Sort(r.peers)
+	return r
+}
+
+// Owner returns the peer responsible for key, or "" for an empty ring.
+func (r *Ring) Owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	i, _ := slices.BinarySearch(r.hashes, hashKey(key))
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+func (r *Ring) Peers() []string {
+	return slices.Clone(r.peers)
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV alone clusters similar keys such as "peer#1" and "peer#2", the
+	// murmur3 finalizer spreads them over the ring.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,293 @@
+package crdt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+// memoryTransport delivers deltas directly to strategies in the same process.
+type memoryTransport struct {
+	mu    sync.Mutex
+	nodes map[string]*Strategy
+	down  map[string]bool
+	// hung peers never answer, sends to them only end with ctx.
+	hung map[string]bool
+}
+
+func (m *memoryTransport) Send(ctx context.Context, peer string, deltas []Delta) error {
+	m.mu.Lock()
+	node, down, hung := m.nodes[peer], m.down[peer], m.hung[peer]
+	m.mu.Unlock()
+
+	if hung {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if down {
+		return errors.New("peer unreachable")
+	}
+	node.Merge(deltas)
+	return nil
+}
+
+// bearer adds the token the receiving node's Authorize expects.
+type bearer string
+
+func (b bearer) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+string(b))
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newCluster(fakeClock *clock.Fake, limit int, ids ...string) ([]*Strategy, *memoryTransport) {
+	transport := &memoryTransport{nodes: map[string]*Strategy{}, down: map[string]bool{}, hung: map[string]bool{}}
+	nodes := make([]*Strategy, len(ids))
+	for i, id := range ids {
+		var peers []string
+		for _, peer := range ids {
+			if peer != id {
+				peers = append(peers, peer)
+			}
+		}
+		nodes[i] = NewStrategy(Config{
+			NodeID:     id,
+			Peers:      peers,
+			Transport:  transport,
+			Limit:      limit,
+			WindowSize: time.Minute,
+		}, fakeClock)
+		transport.nodes[id] = nodes[i]
+	}
+	fakeClock.BlockUntil(len(ids))
+	return nodes, transport
+}
+
+func admit(node *Strategy, identifier string, n int) int {
+	allowed := 0
+	for range n {
+		if ok, _ := node.IsRequestAllowed(identifier); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestGCounter(t *testing.T) {
+	a := GCounter{"a": 3, "b": 1}
+	b := GCounter{"b": 4, "c": 2}
+
+	a.Merge(b)
+	a.Merge(b)
+	if a.Value() != 9 {
+		t.Errorf("expected merging twice to count every slot once for 9 got %d", a.Value())
+	}
+
+	b.Merge(GCounter{"a": 3, "b": 1})
+	if b.Value() != a.Value() {
+		t.Errorf("expected merges in either order to converge got %d and %d", a.Value(), b.Value())
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("nodes enforce the merged count", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, _ := newCluster(fakeClock, 10, "a", "b", "c")
+
+		allowed := admit(nodes[0], "ege", 6)
+		nodes[0].Gossip(context.Background())
+		allowed += admit(nodes[1], "ege", 10)
+		nodes[1].Gossip(context.Background())
+		allowed += admit(nodes[2], "ege", 10)
+
+		for _, node := range nodes {
+			node.Stop()
+		}
+		if allowed != 10 {
+			t.Errorf("expected nodes with a fresh view to admit exactly 10 got %d", allowed)
+		}
+		if ok, remaining := nodes[0].Peek("ege"); ok || remaining != 0 {
+			t.Errorf("expected gossip from the second node to exhaust the first got %v, %d", ok, remaining)
+		}
+	})
+
+	t.Run("stale views over-admit within the bound", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, _ := newCluster(fakeClock, 10, "a", "b", "c")
+		defer func() {
+			for _, node := range nodes {
+				node.Stop()
+			}
+		}()
+
+		allowed := 0
+		for _, node := range nodes {
+			allowed += admit(node, "ege", 10)
+		}
+		if allowed != 30 {
+			t.Errorf("expected partitioned nodes to admit at most N*limit = 30 got %d", allowed)
+		}
+
+		fakeClock.Advance(time.Second)
+		// The gossip ticks have been received; a second round ensures the
+		// first one finished.
+		fakeClock.Advance(time.Second)
+		for _, node := range nodes {
+			if _, remaining := node.Peek("ege"); remaining != 0 {
+				t.Errorf("expected the merged view to be exhausted got %d remaining", remaining)
+			}
+		}
+	})
+
+	t.Run("failed gossip is retried", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, transport := newCluster(fakeClock, 10, "a", "b")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		admit(nodes[0], "ege", 4)
+		transport.down["b"] = true
+		nodes[0].Gossip(context.Background())
+		if _, remaining := nodes[1].Peek("ege"); remaining != 10 {
+			t.Fatalf("expected the unreachable node to see nothing got %d remaining", remaining)
+		}
+
+		transport.down["b"] = false
+		nodes[0].Gossip(context.Background())
+		if _, remaining := nodes[1].Peek("ege"); remaining != 6 {
+			t.Errorf("expected the retried gossip to arrive got %d remaining", remaining)
+		}
+	})
+
+	t.Run("a hung peer does not hold up the others", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, transport := newCluster(fakeClock, 10, "a", "b", "c")
+		for _, node := range nodes {
+			defer node.Stop()
+		}
+
+		admit(nodes[0], "ege", 4)
+		transport.hung["b"] = true
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		nodes[0].Gossip(ctx)
+
+		if _, remaining := nodes[2].Peek("ege"); remaining != 6 {
+			t.Errorf("expected c to receive the counts while b hangs got %d remaining", remaining)
+		}
+	})
+
+	t.Run("resets are gossiped", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, _ := newCluster(fakeClock, 10, "a", "b")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		admit(nodes[0], "ege", 8)
+		nodes[0].Gossip(context.Background())
+		nodes[0].Reset("ege")
+		nodes[0].Gossip(context.Background())
+		if _, remaining := nodes[1].Peek("ege"); remaining != 10 {
+			t.Fatalf("expected the reset to reach the other node got %d remaining", remaining)
+		}
+
+		admit(nodes[0], "ege", 3)
+		nodes[0].Gossip(context.Background())
+		if _, remaining := nodes[1].Peek("ege"); remaining != 7 {
+			t.Errorf("expected admissions after the reset to count got %d remaining", remaining)
+		}
+		if allowed := admit(nodes[1], "ege", 10); allowed != 7 {
+			t.Errorf("expected the nodes to admit the limit after the reset, admitted %d of 7", allowed)
+		}
+	})
+
+	t.Run("counts start over in a new window", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		nodes, _ := newCluster(fakeClock, 2, "a", "b")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		admit(nodes[0], "ege", 2)
+		stale := []Delta{{Key: "ege", Window: start, Node: "a", Count: 2}}
+		fakeClock.Advance(time.Minute)
+
+		nodes[1].Merge(stale)
+		if allowed := admit(nodes[1], "ege", 3); allowed != 2 {
+			t.Errorf("expected deltas of an old window to be ignored, admitted %d of 2", allowed)
+		}
+	})
+
+	t.Run("gossip over http", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		receiver := NewStrategy(Config{NodeID: "b", Limit: 5, WindowSize: time.Minute}, fakeClock)
+		defer receiver.Stop()
+		server := httptest.NewServer(receiver.Handler())
+		defer server.Close()
+
+		sender := NewStrategy(Config{
+			NodeID:     "a",
+			Peers:      []string{server.URL},
+			Transport:  HTTPTransport{},
+			Limit:      5,
+			WindowSize: time.Minute,
+		}, fakeClock)
+		defer sender.Stop()
+
+		admit(sender, "ege", 3)
+		sender.Gossip(context.Background())
+		if _, remaining := receiver.Peek("ege"); remaining != 2 {
+			t.Errorf("expected the receiver to merge 3 requests got %d remaining", remaining)
+		}
+	})
+
+	t.Run("auth hook", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		receiver := NewStrategy(Config{
+			NodeID:     "b",
+			Limit:      5,
+			WindowSize: time.Minute,
+			Authorize: func(r *http.Request) bool {
+				return r.Header.Get("Authorization") == "Bearer secret"
+			},
+		}, fakeClock)
+		defer receiver.Stop()
+		server := httptest.NewServer(receiver.Handler())
+		defer server.Close()
+
+		newSender := func(client *http.Client) *Strategy {
+			return NewStrategy(Config{
+				NodeID:     "a",
+				Peers:      []string{server.URL},
+				Transport:  HTTPTransport{Client: client},
+				Limit:      5,
+				WindowSize: time.Minute,
+			}, fakeClock)
+		}
+
+		intruder := newSender(nil)
+		defer intruder.Stop()
+		admit(intruder, "ege", 5)
+		intruder.Gossip(context.Background())
+		if _, remaining := receiver.Peek("ege"); remaining != 5 {
+			t.Errorf("expected unauthorized deltas to be refused got %d remaining", remaining)
+		}
+
+		peer := newSender(&http.Client{Transport: bearer("secret")})
+		defer peer.Stop()
+		admit(peer, "ege", 2)
+		peer.Gossip(context.Background())
+		if _, remaining := receiver.Peek("ege"); remaining != 3 {
+			t.Errorf("expected authorized deltas to be merged got %d remaining", remaining)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+// Package crdt replicates request counts between nodes with grow-only
+// counters, so every node decides locally against an eventually consistent
+// global count.
+package crdt
+
+// GCounter is a grow-only counter with one slot per node. Merging takes the
+// maximum of each slot, so replicas converge no matter how often or in which
+// order they exchange state.
+type GCounter map[string]uint64
+
+func (g GCounter) Increment(node string) {
+	g[node]++
+}
+
+func (g GCounter) Value() uint64 {
+	var total uint64
+	for _, count := range g {
+		total += count
+	}
+	return total
+}
+
+// Observe merges what a node reported for its own slot.
+func (g GCounter) Observe(node string, count uint64) {
+	if count > g[node] {
+		g[node] = count
+	}
+}
+
+func (g GCounter) Merge(other GCounter) {
+	for node, count := range other {
+		g.Observe(node, count)
+	}
+}
+
+// Since counts what g added on top of base, slot by slot. A base merged by
+// maximum works as a grow-only reset point for g.
+func (g GCounter) Since(base GCounter) uint64 {
+	var total uint64
+	for node, count := range g {
+		if count > base[node] {
+			total += count - base[node]
+		}
+	}
+	return total
+}
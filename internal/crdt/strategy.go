@@ -0,0 +1,270 @@
+package crdt
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+// Delta is a node's count for one key and window, with the key's reset point
+// as the node knows it. Deltas carry absolute values, so lost or repeated
+// gossip is harmless.
+type Delta struct {
+	Key    string    `json:"key"`
+	Window time.Time `json:"window"`
+	Node   string    `json:"node"`
+	Count  uint64    `json:"count"`
+	// Reset holds every slot's value at the key's latest reset.
+	Reset GCounter `json:"reset,omitempty"`
+}
+
+// Transport delivers deltas to a peer, see HTTPTransport.
+type Transport interface {
+	Send(ctx context.Context, peer string, deltas []Delta) error
+}
+
+type Config struct {
+	// NodeID names this node's slot in every counter and must be unique.
+	NodeID string
+	// Peers are the addresses Transport sends to. Gossip is full mesh: each
+	// node sends its own slots to every peer.
+	Peers     []string
+	Transport Transport
+
+	Limit      int
+	WindowSize time.Duration
+	// GossipInterval defaults to one second. A round of gossip is given up
+	// after one interval.
+	GossipInterval time.Duration
+	// Authorize is consulted before Handler merges posted deltas, requests
+	// it refuses are answered with 401. All requests are allowed when it is
+	// nil, so the gossip endpoint must not be reachable by clients.
+	Authorize func(r *http.Request) bool
+}
+
+type windowCounters struct {
+	start    time.Time
+	counters map[string]GCounter
+	// resets holds the counter values keys were reset at. Only the counts
+	// on top of them are enforced.
+	resets map[string]GCounter
+}
+
+// Strategy enforces a fixed window limit against the counts of all nodes it
+// has heard from. The hot path never waits for the network, the price is
+// over-admission while a node's view is stale: with N nodes each admitting r
+// requests per second, a key can exceed its limit by about
+// (N-1) * r * (GossipInterval + delivery latency). While nodes are
+// partitioned each of them may admit the full limit, N * Limit in total.
+type Strategy struct {
+	config       Config
+	timeProvider strategies.TimeProvider
+
+	mu      sync.Mutex
+	current windowCounters
+	grants  map[string]int
+	// dirty holds the keys each peer has not received this node's count of.
+	dirty map[string]map[string]struct{}
+
+	stopGossip chan struct{}
+	gossipDone chan struct{}
+}
+
+func NewStrategy(config Config, timeProvider strategies.TimeProvider) *Strategy {
+	if config.GossipInterval <= 0 {
+		config.GossipInterval = time.Second
+	}
+
+	s := &Strategy{
+		config:       config,
+		timeProvider: timeProvider,
+		grants:       map[string]int{},
+		dirty:        map[string]map[string]struct{}{},
+		stopGossip:   make(chan struct{}),
+		gossipDone:   make(chan struct{}),
+	}
+	for _, peer := range config.Peers {
+		s.dirty[peer] = map[string]struct{}{}
+	}
+
+	go s.startGossip()
+	return s
+}
+
+func (s *Strategy) IsRequestAllowed(identifier string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter := s.counter(identifier, s.timeProvider.Now())
+	limit := s.config.Limit + s.grants[identifier]
+	total := int(counter.Since(s.current.resets[identifier]))
+	if total >= limit {
+		return false, 0
+	}
+
+	counter.Increment(s.config.NodeID)
+	for _, keys := range s.dirty {
+		keys[identifier] = struct{}{}
+	}
+	return true, limit - total - 1
+}
+
+func (s *Strategy) Peek(identifier string) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roll(s.timeProvider.Now())
+	used := s.current.counters[identifier].Since(s.current.resets[identifier])
+	remaining := max(s.config.Limit+s.grants[identifier]-int(used), 0)
+	return remaining > 0, remaining
+}
+
+// Reset starts identifier over on every node. Counters cannot shrink, so the
+// counts this node has seen become the key's reset point, which is gossiped
+// and merged like the counts. Requests other nodes admitted before the reset
+// but this node had not heard of yet still count.
+func (s *Strategy) Reset(identifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset := s.resetPoint(identifier, s.timeProvider.Now())
+	reset.Merge(s.current.counters[identifier])
+	delete(s.grants, identifier)
+	for _, keys := range s.dirty {
+		keys[identifier] = struct{}{}
+	}
+}
+
+// Grant raises identifier's limit on this node until the current window ends.
+func (s *Strategy) Grant(identifier string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roll(s.timeProvider.Now())
+	s.grants[identifier] += n
+}
+
+// Merge applies deltas from a peer. Deltas for other windows are dropped.
+func (s *Strategy) Merge(deltas []Delta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.timeProvider.Now()
+	s.roll(now)
+	for _, delta := range deltas {
+		if delta.Node == s.config.NodeID || !delta.Window.Equal(s.current.start) {
+			continue
+		}
+		s.counter(delta.Key, now).Observe(delta.Node, delta.Count)
+		if len(delta.Reset) > 0 {
+			s.resetPoint(delta.Key, now).Merge(delta.Reset)
+		}
+	}
+}
+
+// Gossip sends this node's changed counts to every peer at once, so a slow
+// peer does not hold up the others. Keys are sent again in the next round if
+// the peer could not be reached.
+func (s *Strategy) Gossip(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, peer := range s.config.Peers {
+		deltas := s.pending(peer)
+		if len(deltas) == 0 {
+			continue
+		}
+
+		wg.Go(func() {
+			if err := s.config.Transport.Send(ctx, peer, deltas); err != nil {
+				s.mu.Lock()
+				for _, delta := range deltas {
+					if delta.Window.Equal(s.current.start) {
+						s.dirty[peer][delta.Key] = struct{}{}
+					}
+				}
+				s.mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (s *Strategy) pending(peer string) []Delta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roll(s.timeProvider.Now())
+	deltas := make([]Delta, 0, len(s.dirty[peer]))
+	for key := range s.dirty[peer] {
+		deltas = append(deltas, Delta{
+			Key:    key,
+			Window: s.current.start,
+			Node:   s.config.NodeID,
+			Count:  s.current.counters[key][s.config.NodeID],
+			Reset:  maps.Clone(s.current.resets[key]),
+		})
+	}
+	s.dirty[peer] = map[string]struct{}{}
+	return deltas
+}
+
+// counter returns identifier's counter for the window containing now.
+func (s *Strategy) counter(identifier string, now time.Time) GCounter {
+	s.roll(now)
+	counter, exists := s.current.counters[identifier]
+	if !exists {
+		counter = GCounter{}
+		s.current.counters[identifier] = counter
+	}
+	return counter
+}
+
+func (s *Strategy) resetPoint(identifier string, now time.Time) GCounter {
+	s.roll(now)
+	reset, exists := s.current.resets[identifier]
+	if !exists {
+		reset = GCounter{}
+		s.current.resets[identifier] = reset
+	}
+	return reset
+}
+
+// roll drops the counters, grants and unsent keys of a window that ended.
+func (s *Strategy) roll(now time.Time) {
+	start := now.Truncate(s.config.WindowSize)
+	if s.current.counters != nil && s.current.start.Equal(start) {
+		return
+	}
+
+	s.current = windowCounters{start: start, counters: map[string]GCounter{}, resets: map[string]GCounter{}}
+	s.grants = map[string]int{}
+	for peer := range s.dirty {
+		s.dirty[peer] = map[string]struct{}{}
+	}
+}
+
+func (s *Strategy) Stop() {
+	close(s.stopGossip)
+	<-s.gossipDone
+}
+
+func (s *Strategy) startGossip() {
+	defer close(s.gossipDone)
+	ticker := clock.From(s.timeProvider).NewTicker(s.config.GossipInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			ctx, cancel := context.WithTimeout(context.Background(), s.config.GossipInterval)
+			s.Gossip(ctx)
+			cancel()
+		case <-s.stopGossip:
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package crdt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// GossipPath is where Handler receives deltas.
+const GossipPath = "/gossip"
+
+// defaultClient bounds every post, in case the caller's context does not.
+var defaultClient = &http.Client{Timeout: 5 * time.Second}
+
+// HTTPTransport posts deltas as JSON to a peer's base URL.
+type HTTPTransport struct {
+	// Client defaults to a client with a five second timeout. Its transport
+	// can add the credentials the peers' Authorize expects.
+	Client *http.Client
+}
+
+func (t HTTPTransport) Send(ctx context.Context, peer string, deltas []Delta) error {
+	body, err := json.Marshal(deltas)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+GossipPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	client := t.Client
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("gossip to %s: %w", peer, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("gossip to %s: unexpected status %d", peer, response.StatusCode)
+	}
+	return nil
+}
+
+// Handler merges deltas posted by HTTPTransport.
+func (s *Strategy) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+GossipPath, func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Authorize != nil && !s.config.Authorize(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var deltas []Delta
+		if err := json.NewDecoder(r.Body).Decode(&deltas); err != nil {
+			http.Error(w, "invalid deltas", http.StatusBadRequest)
+			return
+		}
+		s.Merge(deltas)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,387 @@
+// Package lease lets nodes take batches of a key's quota from a central Store
+// and decide requests locally until the batch is spent or expires.
+package lease
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type Config struct {
+	// Limit is the store's limit per window, used to size batches.
+	Limit int
+	// Duration is how long a lease is kept before its unused tokens are
+	// returned. Defaults to one second.
+	Duration time.Duration
+	// Accuracy caps a single batch at this fraction of Limit. Tokens leased
+	// by one node cannot be used by the others, so a key may be rejected
+	// while up to nodes*Accuracy*Limit of its quota sits unused in leases.
+	// Nodes never admit more than Limit together. Defaults to 0.1.
+	Accuracy float64
+	// MinBatch defaults to 1.
+	MinBatch int
+}
+
+type keyLease struct {
+	tokens    int
+	remaining int
+	start     time.Time
+	expiresAt time.Time
+	windowEnd time.Time
+	used      int
+	// fromGrants counts the admissions of this lease paid by grants.
+	fromGrants int
+	// rate is the key's observed requests per second on this node.
+	rate float64
+}
+
+// keyGrant is extra capacity given to one node. It is never taken from or
+// returned to the store and ends with the store's window.
+type keyGrant struct {
+	n         int
+	windowEnd time.Time
+}
+
+type Stats struct {
+	LocalDecisions int64
+	Acquires       int64
+	Releases       int64
+}
+
+// Strategy decides requests from leased tokens and only goes to the store
+// when a key's lease is spent or expired.
+type Strategy struct {
+	store        Store
+	config       Config
+	timeProvider strategies.TimeProvider
+
+	mu     sync.Mutex
+	leases map[string]*keyLease
+	grants map[string]keyGrant
+
+	localDecisions atomic.Int64
+	acquires       atomic.Int64
+	releases       atomic.Int64
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+}
+
+func NewStrategy(store Store, config Config, timeProvider strategies.TimeProvider) *Strategy {
+	if config.Duration <= 0 {
+		config.Duration = time.Second
+	}
+	if config.Accuracy <= 0 {
+		config.Accuracy = 0.1
+	}
+	if config.MinBatch <= 0 {
+		config.MinBatch = 1
+	}
+
+	s := &Strategy{
+		store:        store,
+		config:       config,
+		timeProvider: timeProvider,
+		leases:       map[string]*keyLease{},
+		grants:       map[string]keyGrant{},
+		stopCleanup:  make(chan struct{}),
+		cleanupDone:  make(chan struct{}),
+	}
+
+	go s.startCleanup()
+	return s
+}
+
+func (s *Strategy) IsRequestAllowed(identifier string) (bool, int) {
+	decision, _ := s.Allow(context.Background(), identifier)
+	return decision.Allowed, decision.Remaining
+}
+
+func (s *Strategy) Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return ratelimiter.Decision{}, err
+	}
+	now := s.timeProvider.Now()
+
+	s.mu.Lock()
+	lease, exists := s.leases[identifier]
+	if exists && now.Before(lease.expiresAt) && (lease.tokens > 0 || lease.remaining == 0) {
+		decision := s.take(identifier, lease, now)
+		s.mu.Unlock()
+		s.localDecisions.Add(1)
+		return decision, nil
+	}
+
+	var expired keyLease
+	rate := 0.0
+	if exists {
+		expired = *lease
+		rate = lease.observedRate(now)
+		delete(s.leases, identifier)
+	}
+	batch := s.batchSize(rate)
+	s.mu.Unlock()
+
+	if expired.tokens > 0 {
+		s.release(ctx, identifier, expired)
+	}
+
+	grant, err := s.store.Acquire(ctx, identifier, batch)
+	s.acquires.Add(1)
+	if err != nil {
+		return ratelimiter.Decision{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease = s.leases[identifier]
+	if lease == nil || !lease.windowEnd.Equal(grant.WindowEnd) {
+		lease = &keyLease{start: now, expiresAt: minTime(now.Add(s.config.Duration), grant.WindowEnd), windowEnd: grant.WindowEnd, rate: rate}
+		s.leases[identifier] = lease
+	}
+	// A concurrent request for the same key may have leased as well, the
+	// batches are merged.
+	lease.tokens += grant.Tokens
+	lease.remaining = grant.Remaining
+	return s.take(identifier, lease, now), nil
+}
+
+// take spends one leased token, or one granted token once the lease is
+// spent. Without either the key stays rejected until the lease expires, so
+// throttled keys do not hit the store either.
+func (s *Strategy) take(identifier string, lease *keyLease, now time.Time) ratelimiter.Decision {
+	extra := s.extra(identifier, now)
+	switch {
+	case lease.tokens > 0:
+		lease.tokens--
+	case extra > 0:
+		extra--
+		s.grants[identifier] = keyGrant{n: extra, windowEnd: s.grants[identifier].windowEnd}
+		lease.fromGrants++
+	default:
+		return ratelimiter.Decision{Allowed: false, Remaining: 0, Source: ratelimiter.SourceStrategy}
+	}
+	lease.used++
+	return ratelimiter.Decision{Allowed: true, Remaining: lease.tokens + lease.remaining + extra, Source: ratelimiter.SourceStrategy}
+}
+
+func (s *Strategy) extra(identifier string, now time.Time) int {
+	granted, exists := s.grants[identifier]
+	if !exists || !now.Before(granted.windowEnd) {
+		return 0
+	}
+	return granted.n
+}
+
+// observedRate blends the rate seen during this lease into the previous
+// estimate.
+func (l *keyLease) observedRate(now time.Time) float64 {
+	elapsed := now.Sub(l.start).Seconds()
+	if elapsed <= 0 {
+		return math.Inf(1)
+	}
+	observed := float64(l.used) / elapsed
+	if l.rate == 0 || math.IsInf(l.rate, 1) {
+		return observed
+	}
+	return 0.5*l.rate + 0.5*observed
+}
+
+// batchSize leases what the key is expected to use during one lease,
+// bounded by the accuracy cap.
+func (s *Strategy) batchSize(rate float64) int {
+	maxBatch := max(int(s.config.Accuracy*float64(s.config.Limit)), s.config.MinBatch)
+	if math.IsInf(rate, 1) {
+		return maxBatch
+	}
+
+	batch := int(math.Ceil(rate * s.config.Duration.Seconds()))
+	return min(max(batch, s.config.MinBatch), maxBatch)
+}
+
+// BatchSize reports how many tokens the current rate estimate of identifier
+// leases.
+func (s *Strategy) BatchSize(identifier string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, exists := s.leases[identifier]
+	if !exists {
+		return s.batchSize(0)
+	}
+	return s.batchSize(lease.rate)
+}
+
+func (s *Strategy) release(ctx context.Context, identifier string, lease keyLease) {
+	// A failed release only leaves the tokens unused until the window ends.
+	s.store.Release(ctx, identifier, lease.tokens, lease.windowEnd)
+	s.releases.Add(1)
+}
+
+func (s *Strategy) Peek(identifier string) (bool, int) {
+	now := s.timeProvider.Now()
+
+	s.mu.Lock()
+	extra := s.extra(identifier, now)
+	lease, exists := s.leases[identifier]
+	if exists && now.Before(lease.expiresAt) && (lease.tokens > 0 || lease.remaining == 0) {
+		defer s.mu.Unlock()
+		remaining := lease.tokens + lease.remaining + extra
+		return remaining > 0, remaining
+	}
+	s.mu.Unlock()
+
+	grant, err := s.store.Acquire(context.Background(), identifier, 0)
+	if err != nil {
+		return false, 0
+	}
+	return grant.Remaining+extra > 0, grant.Remaining + extra
+}
+
+// Reset drops this node's lease and resets the key in the store.
+func (s *Strategy) Reset(identifier string) {
+	s.mu.Lock()
+	delete(s.leases, identifier)
+	delete(s.grants, identifier)
+	s.mu.Unlock()
+
+	s.store.Reset(context.Background(), identifier)
+}
+
+// Grant gives this node n extra tokens of identifier until the store's
+// window ends. They are spent after the leased tokens and never returned to
+// the store, so the other nodes keep their share of Limit.
+func (s *Strategy) Grant(identifier string, n int) {
+	now := s.timeProvider.Now()
+
+	s.mu.Lock()
+	var windowEnd time.Time
+	if lease, exists := s.leases[identifier]; exists {
+		windowEnd = lease.windowEnd
+	}
+	s.mu.Unlock()
+
+	if !now.Before(windowEnd) {
+		grant, err := s.store.Acquire(context.Background(), identifier, 0)
+		if err != nil {
+			return
+		}
+		windowEnd = grant.WindowEnd
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grants[identifier] = keyGrant{n: s.extra(identifier, now) + n, windowEnd: windowEnd}
+}
+
+// Refund gives back n tokens of this node's lease. Tokens paid by grants go
+// back to the grant, the others are returned to the store with the rest of
+// the lease.
+func (s *Strategy) Refund(identifier string, n int) {
+	now := s.timeProvider.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, exists := s.leases[identifier]
+	if !exists {
+		return
+	}
+	if extra, ok := s.grants[identifier]; ok && now.Before(extra.windowEnd) {
+		refunded := min(n, lease.fromGrants)
+		s.grants[identifier] = keyGrant{n: extra.n + refunded, windowEnd: extra.windowEnd}
+		lease.fromGrants -= refunded
+		lease.used -= refunded
+		n -= refunded
+	}
+	refunded := min(n, lease.used-lease.fromGrants)
+	lease.tokens += refunded
+	lease.used -= refunded
+}
+
+func (s *Strategy) Stats() Stats {
+	return Stats{
+		LocalDecisions: s.localDecisions.Load(),
+		Acquires:       s.acquires.Load(),
+		Releases:       s.releases.Load(),
+	}
+}
+
+// Stop returns every unused token to the store.
+func (s *Strategy) Stop() {
+	close(s.stopCleanup)
+	<-s.cleanupDone
+
+	s.mu.Lock()
+	leases := s.leases
+	s.leases = map[string]*keyLease{}
+	s.mu.Unlock()
+
+	for identifier, lease := range leases {
+		if lease.tokens > 0 {
+			s.release(context.Background(), identifier, *lease)
+		}
+	}
+}
+
+func (s *Strategy) startCleanup() {
+	ticker := clock.From(s.timeProvider).NewTicker(s.config.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.cleanup()
+		case <-s.stopCleanup:
+			close(s.cleanupDone)
+			return
+		}
+	}
+}
+
+// cleanup returns the unused tokens of expired leases so other nodes can
+// take them. The lease itself is kept for another Duration so the key's rate
+// is remembered when it comes back.
+func (s *Strategy) cleanup() {
+	now := s.timeProvider.Now()
+
+	s.mu.Lock()
+	expired := map[string]keyLease{}
+	for identifier, lease := range s.leases {
+		if now.Before(lease.expiresAt) {
+			continue
+		}
+		if now.Sub(lease.expiresAt) >= s.config.Duration {
+			delete(s.leases, identifier)
+		}
+		if lease.tokens > 0 && now.Before(lease.windowEnd) {
+			expired[identifier] = *lease
+		}
+		lease.tokens = 0
+	}
+	for identifier, granted := range s.grants {
+		if !now.Before(granted.windowEnd) {
+			delete(s.grants, identifier)
+		}
+	}
+	s.mu.Unlock()
+
+	for identifier, lease := range expired {
+		s.release(context.Background(), identifier, lease)
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
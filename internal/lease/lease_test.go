@@ -0,0 +1,174 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+var errStoreDown = errors.New("store down")
+
+type failingStore struct {
+	*MemoryStore
+}
+
+func (f failingStore) Acquire(ctx context.Context, key string, n int) (Grant, error) {
+	return Grant{}, errStoreDown
+}
+
+func newNodes(store Store, config Config, fakeClock *clock.Fake, n int) []*Strategy {
+	nodes := make([]*Strategy, n)
+	for i := range nodes {
+		nodes[i] = NewStrategy(store, config, fakeClock)
+	}
+	fakeClock.BlockUntil(n)
+	return nodes
+}
+
+func TestLeasing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("nodes never admit more than the limit together", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := NewMemoryStore(100, time.Minute, fakeClock)
+		nodes := newNodes(store, Config{Limit: 100}, fakeClock, 3)
+
+		allowed := 0
+		for i := range 300 {
+			if ok, _ := nodes[i%3].IsRequestAllowed("ege"); ok {
+				allowed++
+			}
+		}
+		for _, node := range nodes {
+			node.Stop()
+		}
+
+		if allowed != 100 {
+			t.Errorf("expected the nodes to admit exactly the limit of 100 got %d", allowed)
+		}
+		if store.RoundTrips() >= 30 {
+			t.Errorf("expected leasing to save round trips, 300 requests took %d", store.RoundTrips())
+		}
+	})
+
+	t.Run("batches adapt to each key's rate", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := NewMemoryStore(100, time.Minute, fakeClock)
+		node := newNodes(store, Config{Limit: 100, Accuracy: 0.25}, fakeClock, 1)[0]
+		defer node.Stop()
+
+		for range 30 {
+			node.IsRequestAllowed("burst")
+		}
+		node.IsRequestAllowed("slow")
+		fakeClock.Advance(time.Second)
+		node.IsRequestAllowed("slow")
+
+		if node.BatchSize("burst") != 25 {
+			t.Errorf("expected a bursting key to lease the accuracy cap of 25 got %d", node.BatchSize("burst"))
+		}
+		if node.BatchSize("slow") != 1 {
+			t.Errorf("expected a key at one request per lease to lease 1 token got %d", node.BatchSize("slow"))
+		}
+		if stats := node.Stats(); stats.LocalDecisions == 0 {
+			t.Errorf("expected bursting requests to be decided locally got %+v", stats)
+		}
+	})
+
+	t.Run("unused tokens are returned when the lease expires", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := NewMemoryStore(20, time.Minute, fakeClock)
+		nodes := newNodes(store, Config{Limit: 20, Accuracy: 0.5}, fakeClock, 2)
+		defer nodes[1].Stop()
+
+		admitted := 0
+		for range 3 {
+			if ok, _ := nodes[0].IsRequestAllowed("ege"); ok {
+				admitted++
+			}
+		}
+		if store.Used("ege") <= admitted {
+			t.Fatalf("expected the first node to hold unused tokens, store has %d used for %d admitted", store.Used("ege"), admitted)
+		}
+
+		// The second tick is only received once the first cleanup is done.
+		fakeClock.Advance(time.Second)
+		fakeClock.Advance(time.Second)
+		nodes[0].Stop()
+
+		if store.Used("ege") != admitted {
+			t.Errorf("expected the store to only count the %d admitted requests got %d", admitted, store.Used("ege"))
+		}
+
+		for range 30 {
+			if ok, _ := nodes[1].IsRequestAllowed("ege"); ok {
+				admitted++
+			}
+		}
+		if admitted != 20 {
+			t.Errorf("expected the second node to use the returned tokens, admitted %d of 20", admitted)
+		}
+	})
+
+	t.Run("stop returns leased tokens", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := NewMemoryStore(100, time.Minute, fakeClock)
+		node := newNodes(store, Config{Limit: 100}, fakeClock, 1)[0]
+
+		node.IsRequestAllowed("ege")
+		node.IsRequestAllowed("ege")
+		node.Stop()
+
+		if store.Used("ege") != 2 {
+			t.Errorf("expected 2 tokens used after stop got %d", store.Used("ege"))
+		}
+	})
+
+	t.Run("granted tokens are never returned to the store", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := NewMemoryStore(10, time.Minute, fakeClock)
+		nodes := newNodes(store, Config{Limit: 10, Accuracy: 0.5}, fakeClock, 2)
+		defer nodes[1].Stop()
+
+		nodes[0].IsRequestAllowed("ege")
+		nodes[0].Grant("ege", 5)
+		admitted := 1
+		for range 20 {
+			if ok, _ := nodes[0].IsRequestAllowed("ege"); ok {
+				admitted++
+			}
+		}
+		nodes[0].Refund("ege", 1)
+		nodes[0].Stop()
+		if admitted != 15 {
+			t.Fatalf("expected the first node to admit its 10 leased and 5 granted tokens got %d", admitted)
+		}
+
+		if store.Used("ege") != 10 {
+			t.Errorf("expected the store to still count the 10 admitted tokens got %d", store.Used("ege"))
+		}
+		if ok, _ := nodes[1].IsRequestAllowed("ege"); ok {
+			t.Error("expected the second node to be rejected once the limit is used")
+		}
+	})
+
+	t.Run("store errors reach the caller", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		store := failingStore{NewMemoryStore(100, time.Minute, fakeClock)}
+		node := newNodes(store, Config{Limit: 100}, fakeClock, 1)[0]
+		defer node.Stop()
+
+		if _, err := node.Allow(context.Background(), "ege"); !errors.Is(err, errStoreDown) {
+			t.Errorf("expected the store error got %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := node.Allow(ctx, "ege"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancelled context to be reported got %v", err)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package lease
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+// Grant is the part of a key's quota a node took from the store.
+type Grant struct {
+	Tokens int
+	// Remaining is what the store has left for the key after the grant.
+	Remaining int
+	// WindowEnd is when the granted tokens expire at the latest.
+	WindowEnd time.Time
+}
+
+// Store is the central quota every node leases from, usually backed by a
+// shared database.
+type Store interface {
+	// Acquire takes up to n tokens of key's current window. Acquiring zero
+	// tokens only reports what is left.
+	Acquire(ctx context.Context, key string, n int) (Grant, error)
+	// Release returns unused tokens. Tokens of a window that has ended are
+	// dropped.
+	Release(ctx context.Context, key string, n int, windowEnd time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type storeWindow struct {
+	used  int
+	start time.Time
+}
+
+// MemoryStore is a fixed window Store for nodes in one process and for
+// tests.
+type MemoryStore struct {
+	limit        int
+	windowSize   time.Duration
+	timeProvider strategies.TimeProvider
+
+	mu      sync.Mutex
+	windows map[string]storeWindow
+
+	acquires atomic.Int64
+	releases atomic.Int64
+}
+
+func NewMemoryStore(limit int, windowSize time.Duration, timeProvider strategies.TimeProvider) *MemoryStore {
+	return &MemoryStore{
+		limit:        limit,
+		windowSize:   windowSize,
+		timeProvider: timeProvider,
+		windows:      map[string]storeWindow{},
+	}
+}
+
+func (m *MemoryStore) Acquire(ctx context.Context, key string, n int) (Grant, error) {
+	if err := ctx.Err(); err != nil {
+		return Grant{}, err
+	}
+	m.acquires.Add(1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window := m.current(key)
+	granted := max(min(n, m.limit-window.used), 0)
+	window.used += granted
+	m.windows[key] = window
+
+	return Grant{Tokens: granted, Remaining: m.limit - window.used, WindowEnd: window.start.Add(m.windowSize)}, nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string, n int, windowEnd time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.releases.Add(1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window := m.current(key)
+	if window.start.Add(m.windowSize).Equal(windowEnd) {
+		window.used -= min(n, window.used)
+		m.windows[key] = window
+	}
+	return nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.windows, key)
+	return nil
+}
+
+// Used reports how many tokens of key's current window are held by nodes.
+func (m *MemoryStore) Used(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current(key).used
+}
+
+// RoundTrips counts the Acquire and Release calls the store has served.
+func (m *MemoryStore) RoundTrips() int64 {
+	return m.acquires.Load() + m.releases.Load()
+}
+
+func (m *MemoryStore) current(key string) storeWindow {
+	start := m.timeProvider.Now().Truncate(m.windowSize)
+	window, exists := m.windows[key]
+	if !exists || !window.start.Equal(start) {
+		return storeWindow{start: start}
+	}
+	return window
+}
@@ -0,0 +1,137 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type configFile struct {
+	Policies []policyConfig `json:"policies"`
+}
+
+type policyConfig struct {
+	Name             string         `json:"name"`
+	Strategy         string         `json:"strategy"`
+	Limit            int            `json:"limit"`
+	Window           string         `json:"window"`
+	Location         string         `json:"location"`
+	MaxKeys          int            `json:"max_keys"`
+	EvictionPolicy   string         `json:"eviction_policy"`
+	SnapshotPath     string         `json:"snapshot_path"`
+	SnapshotInterval string         `json:"snapshot_interval"`
+	Shadow           bool           `json:"shadow"`
+	Params           map[string]any `json:"params"`
+	Priorities       []struct {
+		Name  string  `json:"name"`
+		Share float64 `json:"share"`
+	} `json:"priorities"`
+}
+
+// LoadConfigFile reads policies from a JSON file such as
+//
+//	{"policies": [{"name": "api", "strategy": "token_bucket", "limit": 100, "window": "1m"}]}
+//
+// Strategies are looked up in the registry, so custom strategies must be
+// registered before the file is loaded.
+func LoadConfigFile(path string) ([]*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return configs, nil
+}
+
+func ParseConfig(data []byte) ([]*Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var file configFile
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	configs := make([]*Config, 0, len(file.Policies))
+	for i, policy := range file.Policies {
+		config, err := policy.config()
+		if err != nil {
+			name := policy.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i)
+			}
+			return nil, fmt.Errorf("policy %s: %w", name, err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+func (p policyConfig) config() (*Config, error) {
+	config := &Config{
+		Name:         p.Name,
+		Strategy:     p.Strategy,
+		Limit:        p.Limit,
+		MaxKeys:      p.MaxKeys,
+		SnapshotPath: p.SnapshotPath,
+		Shadow:       p.Shadow,
+		Params:       p.Params,
+	}
+
+	for _, class := range p.Priorities {
+		config.Priorities = append(config.Priorities, PriorityClass{Name: class.Name, Share: class.Share})
+	}
+	if len(config.Priorities) > 0 {
+		if err := validatePriorityClasses(config.Priorities); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if config.WindowSize, err = parseOptionalDuration(p.Window); err != nil {
+		return nil, fmt.Errorf("window: %w", err)
+	}
+	if config.SnapshotInterval, err = parseOptionalDuration(p.SnapshotInterval); err != nil {
+		return nil, fmt.Errorf("snapshot_interval: %w", err)
+	}
+	if p.Location != "" {
+		if config.Location, err = time.LoadLocation(p.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	switch p.EvictionPolicy {
+	case "", "lru":
+		config.EvictionPolicy = strategies.EvictLeastRecentlyUsed
+	case "deny_new":
+		config.EvictionPolicy = strategies.DenyNewKeys
+	default:
+		return nil, fmt.Errorf("unknown eviction_policy %q, expected lru or deny_new", p.EvictionPolicy)
+	}
+
+	// Catch unknown strategies and bad parameters now instead of when the
+	// limiter is built.
+	definition, err := LookupStrategy(config.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := definition.parse(strategyParams(definition, config.Limit, config.WindowSize, config.Params)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseOptionalDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
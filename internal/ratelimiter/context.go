@@ -0,0 +1,36 @@
+package ratelimiter
+
+import "context"
+
+// ContextStrategy is implemented by strategies that can block or fail, such
+// as networked backends. Ratelimiter.Allow prefers it over IsRequestAllowed.
+type ContextStrategy interface {
+	Allow(ctx context.Context, identifier string) (Decision, error)
+}
+
+// Adapt lets an in-memory strategy satisfy ContextStrategy. The adapter only
+// fails when ctx is already done.
+func Adapt(strategy RateLimitStrategy) ContextStrategy {
+	if contextual, ok := strategy.(ContextStrategy); ok {
+		return contextual
+	}
+	return inMemoryStrategy{strategy: strategy}
+}
+
+type inMemoryStrategy struct {
+	strategy RateLimitStrategy
+}
+
+func (s inMemoryStrategy) Allow(ctx context.Context, identifier string) (Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	allowed, remaining := s.strategy.IsRequestAllowed(identifier)
+	decision := Decision{Allowed: allowed, Remaining: remaining, Source: SourceStrategy}
+	if inspectable, ok := s.strategy.(InspectableStrategy); ok && !allowed {
+		state, _ := inspectable.InspectKey(identifier)
+		decision.RetryAt = state.RetryAt
+	}
+	return decision, nil
+}
@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+var errBackendDown = errors.New("backend down")
+
+// remoteStrategy stands in for a networked backend.
+type remoteStrategy struct {
+	*strategies.FixedWindowStrategy
+	err error
+}
+
+func (s *remoteStrategy) Allow(ctx context.Context, identifier string) (Decision, error) {
+	if s.err != nil {
+		return Decision{}, s.err
+	}
+	allowed, remaining := s.IsRequestAllowed(identifier)
+	return Decision{Allowed: allowed, Remaining: remaining, Source: SourceStrategy}, nil
+}
+
+func TestAllow(t *testing.T) {
+	t.Run("adapts in-memory strategies", func(t *testing.T) {
+		rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{currentTime: time.Now()}, "fixed_window")
+		defer rl.Stop()
+
+		if decision, err := rl.Allow(context.Background(), "ege"); err != nil || !decision.Allowed {
+			t.Errorf("first request should be allowed got %+v %v", decision, err)
+		}
+		if decision, err := rl.Allow(context.Background(), "ege"); err != nil || decision.Allowed {
+			t.Errorf("second request should be rejected got %+v %v", decision, err)
+		}
+	})
+
+	t.Run("done context does not consume quota", func(t *testing.T) {
+		rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{currentTime: time.Now()}, "fixed_window")
+		defer rl.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := rl.Allow(ctx, "ege"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled got %v", err)
+		}
+		if allowed, _ := rl.IsRequestAllowed("ege"); !allowed {
+			t.Error("cancelled request should not have used the quota")
+		}
+	})
+
+	t.Run("returns strategy errors", func(t *testing.T) {
+		strategy := &remoteStrategy{
+			FixedWindowStrategy: strategies.NewFixedWindowStrategy(10, time.Minute, &MockTimeProvider{currentTime: time.Now()}),
+			err:                 errBackendDown,
+		}
+		rl := NewRateLimiterWithStrategy(strategy)
+		defer rl.Stop()
+
+		if _, err := rl.Allow(context.Background(), "ege"); !errors.Is(err, errBackendDown) {
+			t.Errorf("expected the backend error got %v", err)
+		}
+		if decision := rl.Decide("ege"); decision.Allowed {
+			t.Error("Decide should reject when the strategy fails")
+		}
+
+		strategy.err = nil
+		if decision, err := rl.Allow(context.Background(), "ege"); err != nil || decision.Remaining != 9 {
+			t.Errorf("expected the context strategy to be used got %+v %v", decision, err)
+		}
+	})
+
+	t.Run("penalty box does not count errors as rejections", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Now()}
+		strategy := &remoteStrategy{
+			FixedWindowStrategy: strategies.NewFixedWindowStrategy(10, time.Minute, mockTimeProvider),
+			err:                 errBackendDown,
+		}
+		box := NewPenaltyBox(NewRateLimiterWithStrategy(strategy), PenaltyConfig{Threshold: 1, Window: time.Minute, BanDuration: time.Hour}, mockTimeProvider)
+		defer box.Stop()
+
+		if _, err := box.Allow(context.Background(), "ege"); !errors.Is(err, errBackendDown) {
+			t.Errorf("expected the backend error got %v", err)
+		}
+		if len(box.Bans()) != 0 {
+			t.Errorf("errors should not ban got %+v", box.Bans())
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package ratelimiter
+
+import (
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+)
+
+// Unlimited is reported as Remaining for identifiers that are not limited.
+const Unlimited = -1
+
+type DecisionSource int
+
+const (
+	SourceStrategy DecisionSource = iota
+	SourceAllowList
+	SourceDenyList
+	SourcePenaltyBox
+)
+
+func (s DecisionSource) String() string {
+	switch s {
+	case SourceAllowList:
+		return "allow_list"
+	case SourceDenyList:
+		return "deny_list"
+	case SourcePenaltyBox:
+		return "penalty_box"
+	default:
+		return "strategy"
+	}
+}
+
+type Decision struct {
+	Allowed   bool
+	Remaining int
+	Source    DecisionSource
+	// Shadowed marks a rejection that was let through by shadow mode.
+	Shadowed bool
+	// Degraded marks a decision made without the backend, see
+	// ResilientStrategy.
+	Degraded bool
+	// RetryAt is when a rejected identifier is allowed again, zero if the
+	// strategy cannot tell.
+	RetryAt time.Time
+}
+
+// CheckAccessList returns the decision of list for identifier, or false if
+// the identifier is on neither list and the strategy has to decide.
+func CheckAccessList(list *accesslist.List, identifier string) (Decision, bool) {
+	if list == nil {
+		return Decision{}, false
+	}
+
+	switch list.Match(identifier) {
+	case accesslist.Allow:
+		return Decision{Allowed: true, Remaining: Unlimited, Source: SourceAllowList}, true
+	case accesslist.Deny:
+		return Decision{Allowed: false, Remaining: 0, Source: SourceDenyList}, true
+	}
+	return Decision{}, false
+}
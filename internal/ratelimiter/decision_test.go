@@ -0,0 +1,52 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+)
+
+func TestDecideWithAccessList(t *testing.T) {
+	rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{}, "fixed_window")
+	defer rl.Stop()
+
+	list, _ := accesslist.New([]string{"10.0.0.0/8"}, []string{"203.0.113.0/24"})
+	rl.SetAccessList(list)
+
+	t.Run("allow list skips the strategy", func(t *testing.T) {
+		for range 3 {
+			decision := rl.Decide("10.1.1.1")
+			if !decision.Allowed || decision.Source != SourceAllowList {
+				t.Errorf("expected allowed by allow list got %+v", decision)
+			}
+		}
+	})
+
+	t.Run("deny list blocks without consulting the strategy", func(t *testing.T) {
+		decision := rl.Decide("203.0.113.9")
+		if decision.Allowed || decision.Source != SourceDenyList {
+			t.Errorf("expected denied by deny list got %+v", decision)
+		}
+	})
+
+	t.Run("other identifiers are decided by the strategy", func(t *testing.T) {
+		decision := rl.Decide("ege")
+		if !decision.Allowed || decision.Source != SourceStrategy {
+			t.Errorf("expected allowed by strategy got %+v", decision)
+		}
+
+		decision = rl.Decide("ege")
+		if decision.Allowed || decision.Source != SourceStrategy {
+			t.Errorf("expected denied by strategy got %+v", decision)
+		}
+	})
+
+	t.Run("reloaded lists apply immediately", func(t *testing.T) {
+		list.Reload([]string{"ege"}, nil)
+
+		if decision := rl.Decide("ege"); !decision.Allowed || decision.Source != SourceAllowList {
+			t.Errorf("expected allowed by reloaded allow list got %+v", decision)
+		}
+	})
+}
@@ -0,0 +1,19 @@
+package ratelimiter
+
+import "fmt"
+
+type WeightedStrategy interface {
+	SetWeight(identifier string, weight float64)
+}
+
+// SetWeight changes identifier's share of a fair share limit relative to
+// the default weight of 1.
+func (r *Ratelimiter) SetWeight(identifier string, weight float64) error {
+	weighted, ok := r.strategy.(WeightedStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support weights", r.strategy)
+	}
+
+	weighted.SetWeight(identifier, weight)
+	return nil
+}
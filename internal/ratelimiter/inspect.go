@@ -0,0 +1,63 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type InspectableStrategy interface {
+	Inspect() []strategies.KeyState
+	InspectKey(identifier string) (strategies.KeyState, bool)
+}
+
+func (r *Ratelimiter) Name() string {
+	if r.name != "" {
+		return r.name
+	}
+	return r.strategyName
+}
+
+func (r *Ratelimiter) StrategyName() string {
+	return r.strategyName
+}
+
+// Inspect lists every identifier the strategy tracks without consuming quota.
+func (r *Ratelimiter) Inspect() ([]strategies.KeyState, error) {
+	inspectable, err := r.inspectable()
+	if err != nil {
+		return nil, err
+	}
+	return inspectable.Inspect(), nil
+}
+
+func (r *Ratelimiter) InspectKey(identifier string) (strategies.KeyState, bool, error) {
+	inspectable, err := r.inspectable()
+	if err != nil {
+		return strategies.KeyState{}, false, err
+	}
+	state, tracked := inspectable.InspectKey(identifier)
+	return state, tracked, nil
+}
+
+// Top returns the n identifiers with the highest counts.
+func (r *Ratelimiter) Top(n int) ([]strategies.KeyState, error) {
+	states, err := r.Inspect()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(states, func(i, j int) bool {
+		return states[i].Count > states[j].Count
+	})
+	return states[:min(n, len(states))], nil
+}
+
+func (r *Ratelimiter) inspectable() (InspectableStrategy, error) {
+	inspectable, ok := r.strategy.(InspectableStrategy)
+	if !ok {
+		return nil, fmt.Errorf("strategy %T cannot be inspected", r.strategy)
+	}
+	return inspectable, nil
+}
@@ -0,0 +1,31 @@
+package ratelimiter
+
+import (
+	"fmt"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type BoundedStrategy interface {
+	SetKeyLimit(maxKeys int, policy strategies.EvictionPolicy)
+	Evictions() int64
+}
+
+// SetKeyLimit caps how many identifiers the strategy tracks at once and
+// decides what happens to new identifiers when the cap is reached.
+func (r *Ratelimiter) SetKeyLimit(maxKeys int, policy strategies.EvictionPolicy) error {
+	bounded, ok := r.strategy.(BoundedStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support key limits", r.strategy)
+	}
+
+	bounded.SetKeyLimit(maxKeys, policy)
+	return nil
+}
+
+func (r *Ratelimiter) Evictions() int64 {
+	if bounded, ok := r.strategy.(BoundedStrategy); ok {
+		return bounded.Evictions()
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package ratelimiter
+
+import (
+	"fmt"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type ConfigurableStrategy interface {
+	SetLimitProvider(provider strategies.LimitProvider)
+}
+
+// SetLimitProvider resolves limits per identifier through provider instead of
+// the limit and window the strategy was built with. It can be swapped while
+// the limiter serves requests.
+func (r *Ratelimiter) SetLimitProvider(provider strategies.LimitProvider) error {
+	configurable, ok := r.strategy.(ConfigurableStrategy)
+	if !ok {
+		return fmt.Errorf("strategy %T does not support limit providers", r.strategy)
+	}
+
+	configurable.SetLimitProvider(provider)
+	return nil
+}
@@ -1,28 +1,161 @@
 package ratelimiter
 
 import (
+	"context"
+	"maps"
+	"sync/atomic"
 	"time"
 
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
 	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
 )
 
 type RateLimitStrategy interface {
 	IsRequestAllowed(identifier string) (bool, int)
+	// Peek reports whether the next request would be allowed and how many
+	// requests are left, without consuming one.
+	Peek(identifier string) (bool, int)
+	Reset(identifier string)
+	// Grant temporarily raises identifier's limit by n.
+	Grant(identifier string, n int)
 	Stop()
 }
 
 type Ratelimiter struct {
-	strategy RateLimitStrategy
+	name         string
+	strategy     RateLimitStrategy
+	strategyName string
+	persistence  *persistence
+	timeProvider strategies.TimeProvider
+	// accessList and shadow can be changed while requests are decided.
+	accessList atomic.Pointer[accesslist.List]
+	shadow     atomic.Pointer[shadowMode]
 }
 
 type Config struct {
+	// Name identifies the policy in logs and the admin API. Defaults to the
+	// strategy name.
+	Name       string
 	Strategy   string
 	Limit      int
 	WindowSize time.Duration
+	// Location is the time zone calendar strategies reset in, UTC if nil.
+	Location *time.Location
+	// LocationFor resolves the time zone per identifier, falling back to
+	// Location when it returns nil.
+	LocationFor func(identifier string) *time.Location
+
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	// OnSnapshotError is called when a periodic snapshot cannot be saved.
+	// Defaults to logging the error with slog.
+	OnSnapshotError func(err error)
+
+	MaxKeys        int
+	EvictionPolicy strategies.EvictionPolicy
+
+	Shadow         bool
+	ShadowObserver ShadowObserver
+
+	// LimitProvider overrides Limit and WindowSize per identifier.
+	LimitProvider strategies.LimitProvider
+
+	// TimeProvider defaults to real time.
+	TimeProvider strategies.TimeProvider
+
+	// Params holds the parameters of registered strategies beyond Limit and
+	// WindowSize.
+	Params map[string]any
+
+	// Priorities splits the limit between priority classes, see
+	// PriorityStrategy.
+	Priorities []PriorityClass
 }
 
+// NewRatelimiterWithConfig panics if config names an unknown strategy or
+// invalid parameters. Use NewFromConfig to handle the error instead.
 func NewRatelimiterWithConfig(config *Config) *Ratelimiter {
-	return NewRateLimiter(config.Limit, config.WindowSize, &strategies.RealTimeProvider{}, config.Strategy)
+	rl, err := NewFromConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	return rl
+}
+
+func NewFromConfig(config *Config) (*Ratelimiter, error) {
+	timeProvider := config.TimeProvider
+	if timeProvider == nil {
+		timeProvider = &strategies.RealTimeProvider{}
+	}
+
+	definition, err := LookupStrategy(config.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	var strategy RateLimitStrategy
+	if len(config.Priorities) > 0 {
+		strategy, err = newPriorityStrategy(definition, config.Limit, config.WindowSize, config.Params, config.Priorities, timeProvider)
+	} else {
+		strategy, err = definition.Build(strategyParams(definition, config.Limit, config.WindowSize, config.Params), timeProvider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rl := NewRateLimiterWithStrategy(strategy)
+	rl.strategyName = config.Strategy
+	rl.name = config.Name
+	rl.timeProvider = timeProvider
+	if calendar, ok := rl.strategy.(*strategies.CalendarQuotaStrategy); ok {
+		if config.Location != nil {
+			calendar.SetLocation(config.Location)
+		}
+		if config.LocationFor != nil {
+			calendar.SetLocationFunc(config.LocationFor)
+		}
+	}
+	if config.Shadow {
+		rl.SetShadow(true, config.ShadowObserver)
+	}
+	if config.MaxKeys > 0 {
+		if err := rl.SetKeyLimit(config.MaxKeys, config.EvictionPolicy); err != nil {
+			rl.Stop()
+			return nil, err
+		}
+	}
+	if config.LimitProvider != nil {
+		if err := rl.SetLimitProvider(config.LimitProvider); err != nil {
+			rl.Stop()
+			return nil, err
+		}
+	}
+	if config.SnapshotPath != "" {
+		if _, err := rl.stateful(); err != nil {
+			rl.Stop()
+			return nil, err
+		}
+		if err := rl.enablePersistence(config.SnapshotPath, config.SnapshotInterval, config.OnSnapshotError); err != nil {
+			rl.Stop()
+			return nil, err
+		}
+	}
+	return rl, nil
+}
+
+// strategyParams passes limit and windowSize on to strategies that declare
+// them.
+func strategyParams(definition StrategyDefinition, limit int, windowSize time.Duration, extra map[string]any) map[string]any {
+	params := maps.Clone(extra)
+	if params == nil {
+		params = map[string]any{}
+	}
+	if limit != 0 && definition.HasParam("limit") {
+		params["limit"] = limit
+	}
+	if windowSize != 0 && definition.HasParam("window") {
+		params["window"] = windowSize
+	}
+	return params
 }
 
 func NewRateLimiterWithStrategy(strategy RateLimitStrategy) *Ratelimiter {
@@ -30,22 +163,79 @@ func NewRateLimiterWithStrategy(strategy RateLimitStrategy) *Ratelimiter {
 }
 
 func (r *Ratelimiter) IsRequestAllowed(identifier string) (bool, int) {
-	return r.strategy.IsRequestAllowed(identifier)
+	decision := r.Decide(identifier)
+	return decision.Allowed, decision.Remaining
+}
+
+// Decide is Allow without a deadline. It rejects the request if the strategy
+// fails.
+func (r *Ratelimiter) Decide(identifier string) Decision {
+	decision, err := r.Allow(context.Background(), identifier)
+	if err != nil {
+		return Decision{Allowed: false, Remaining: 0, Source: SourceStrategy}
+	}
+	return decision
+}
+
+// Allow returns ctx's error without consulting the strategy if ctx is already
+// done, and the strategy's error if it implements ContextStrategy and fails.
+func (r *Ratelimiter) Allow(ctx context.Context, identifier string) (Decision, error) {
+	return r.allow(ctx, identifier, Adapt(r.strategy).Allow)
+}
+
+// allow is Allow with decide in place of the strategy, the access list and
+// shadow mode apply to every way of deciding a request.
+func (r *Ratelimiter) allow(ctx context.Context, identifier string, decide func(ctx context.Context, identifier string) (Decision, error)) (Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+
+	decision, listed := CheckAccessList(r.accessList.Load(), identifier)
+	if !listed {
+		var err error
+		if decision, err = decide(ctx, identifier); err != nil {
+			return Decision{}, err
+		}
+	}
+
+	if shadow := r.shadow.Load(); shadow != nil {
+		return shadow.apply(identifier, decision), nil
+	}
+	return decision, nil
+}
+
+// Peek decides like Decide without consuming quota or counting towards
+// shadow mode.
+func (r *Ratelimiter) Peek(identifier string) Decision {
+	if decision, listed := CheckAccessList(r.accessList.Load(), identifier); listed {
+		return decision
+	}
+
+	allowed, remaining := r.strategy.Peek(identifier)
+	return Decision{Allowed: allowed, Remaining: remaining, Source: SourceStrategy}
+}
+
+func (r *Ratelimiter) Reset(identifier string) {
+	r.strategy.Reset(identifier)
+}
+
+func (r *Ratelimiter) Grant(identifier string, n int) {
+	r.strategy.Grant(identifier, n)
+}
+
+// SetAccessList makes listed identifiers bypass the strategy. The list can be
+// reloaded afterwards without calling SetAccessList again.
+func (r *Ratelimiter) SetAccessList(list *accesslist.List) {
+	r.accessList.Store(list)
 }
 
 func (r *Ratelimiter) Stop() {
+	r.stopPersistence()
 	r.strategy.Stop()
 }
 
+// NewRateLimiter builds one of the registered strategies and panics if it
+// cannot.
 func NewRateLimiter(limit int, windowSize time.Duration, timeProvider strategies.TimeProvider, strategyName string) *Ratelimiter {
-	var strategy RateLimitStrategy
-	if strategyName == "fixed_window" {
-		strategy = strategies.NewFixedWindowStrategy(limit, windowSize, timeProvider)
-	} else if strategyName == "sliding_window_log" {
-		strategy = strategies.NewSlidingWindowLogStrategy(limit, windowSize, timeProvider)
-	} else if strategyName == "sliding_window_counter" {
-		strategy = strategies.NewSlidingWindowCountStrategy(limit, windowSize, timeProvider)
-	}
-
-	return NewRateLimiterWithStrategy(strategy)
+	return NewRatelimiterWithConfig(&Config{Strategy: strategyName, Limit: limit, WindowSize: windowSize, TimeProvider: timeProvider})
 }
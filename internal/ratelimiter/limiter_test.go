@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -186,3 +187,170 @@ func TestIsRequestAllowedSlidingWindowCount(t *testing.T) {
 		t.Errorf("Burst around boundaries should not be allowed got %t, %d", allowed, count)
 	}
 }
+
+func TestRateLimiterKeyLimit(t *testing.T) {
+	config := &Config{
+		Strategy:   "fixed_window",
+		Limit:      10,
+		WindowSize: time.Minute,
+		MaxKeys:    1,
+	}
+
+	rl := NewRatelimiterWithConfig(config)
+	defer rl.Stop()
+
+	rl.IsRequestAllowed("ege")
+	rl.IsRequestAllowed("other")
+
+	if rl.Evictions() != 1 {
+		t.Errorf("expected 1 eviction got %d", rl.Evictions())
+	}
+}
+
+func TestNewFromConfigUnsupportedOptions(t *testing.T) {
+	base := Config{
+		Strategy:   "fixed_window",
+		Limit:      10,
+		WindowSize: time.Minute,
+		Priorities: []PriorityClass{{Name: "critical", Share: 0.2}},
+	}
+
+	withMaxKeys := base
+	withMaxKeys.MaxKeys = 1
+	if _, err := NewFromConfig(&withMaxKeys); err == nil {
+		t.Error("expected MaxKeys to be rejected for a strategy without key limits")
+	}
+
+	withProvider := base
+	withProvider.LimitProvider = strategies.LimitProviderFunc(func(identifier string) strategies.Limits {
+		return strategies.Limits{}
+	})
+	if _, err := NewFromConfig(&withProvider); err == nil {
+		t.Error("expected LimitProvider to be rejected for a strategy without limit providers")
+	}
+}
+
+func TestRateLimiterCalendarQuota(t *testing.T) {
+	config := &Config{
+		Strategy: "calendar_month",
+		Limit:    10000,
+		Location: time.FixedZone("EST", -5*60*60),
+	}
+
+	rl := NewRatelimiterWithConfig(config)
+	defer rl.Stop()
+
+	rl.IsRequestAllowed("ege")
+	usage, err := rl.Usage("ege")
+
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage.Used != 1 || usage.Remaining != 9999 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if usage.PeriodStart.Day() != 1 || usage.PeriodStart.Hour() != 0 || usage.PeriodStart.Location().String() != "EST" {
+		t.Errorf("expected the period to start at local midnight on the 1st got %v", usage.PeriodStart)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	rl := NewRateLimiter(10, time.Minute, &MockTimeProvider{}, "fixed_window")
+	defer rl.Stop()
+
+	rl.IsRequestAllowed("ege")
+
+	for range 3 {
+		if decision := rl.Peek("ege"); !decision.Allowed || decision.Remaining != 9 {
+			t.Errorf("expected 9 remaining got %+v", decision)
+		}
+	}
+}
+
+func TestRateLimiterLimitProvider(t *testing.T) {
+	config := &Config{
+		Strategy:   "fixed_window",
+		Limit:      10,
+		WindowSize: time.Minute,
+		LimitProvider: strategies.LimitProviderFunc(func(identifier string) strategies.Limits {
+			if identifier == "free" {
+				return strategies.Limits{Limit: 1}
+			}
+			return strategies.Limits{}
+		}),
+	}
+
+	rl := NewRatelimiterWithConfig(config)
+	defer rl.Stop()
+
+	if _, remaining := rl.IsRequestAllowed("free"); remaining != 0 {
+		t.Errorf("expected the free plan limit got %d remaining", remaining)
+	}
+	if _, remaining := rl.IsRequestAllowed("pro"); remaining != 9 {
+		t.Errorf("expected the default limit got %d remaining", remaining)
+	}
+}
+
+func TestRateLimiterFairShare(t *testing.T) {
+	tp := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	rl := NewRateLimiter(8, time.Minute, tp, "fair_share")
+	defer rl.Stop()
+
+	if err := rl.SetWeight("gold", 3); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for range 10 {
+		rl.IsRequestAllowed("gold")
+		rl.IsRequestAllowed("bronze")
+	}
+	tp.Advance(time.Minute)
+
+	allowed := 0
+	for range 10 {
+		if ok, _ := rl.IsRequestAllowed("bronze"); ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("expected bronze to get a quarter of 8 got %d", allowed)
+	}
+
+	plain := NewRateLimiter(1, time.Minute, tp, "fixed_window")
+	defer plain.Stop()
+	if err := plain.SetWeight("gold", 3); err == nil {
+		t.Error("expected an error for strategies without weights")
+	}
+}
+
+func TestRateLimiterRefund(t *testing.T) {
+	tp := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	rl := NewRateLimiter(1, time.Minute, tp, "fixed_window")
+	defer rl.Stop()
+
+	rl.IsRequestAllowed("ege")
+	if err := rl.Refund("ege", 1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if ok, _ := rl.IsRequestAllowed("ege"); !ok {
+		t.Error("expected the refunded request to be allowed again")
+	}
+
+	if err := NewRateLimiterWithStrategy(&everyNth{n: 1, seen: map[string]int{}}).Refund("ege", 1); !errors.Is(err, ErrRefundUnsupported) {
+		t.Errorf("expected an error for strategies without refunds got %v", err)
+	}
+
+	priority, err := NewFromConfig(&Config{
+		Strategy:   "sliding_window_log",
+		Limit:      10,
+		WindowSize: time.Minute,
+		Priorities: []PriorityClass{{Name: "critical", Share: 0.2}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer priority.Stop()
+	if !priority.CanRefund() {
+		t.Error("expected priority classes over a refundable strategy to support refunds")
+	}
+}
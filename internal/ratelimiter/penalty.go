@@ -0,0 +1,229 @@
+package ratelimiter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type PenaltyConfig struct {
+	// Threshold rejections within Window put an identifier in the box.
+	Threshold int
+	Window    time.Duration
+
+	BanDuration time.Duration
+	// Multiplier grows the ban for every repeated offense, 1 or less keeps
+	// it constant. MaxBanDuration caps the growth when set.
+	Multiplier     float64
+	MaxBanDuration time.Duration
+	// ForgetAfter is how long after its last ban an identifier counts as a
+	// first offender again. Defaults to a day.
+	ForgetAfter time.Duration
+}
+
+type Ban struct {
+	Identifier string
+	Until      time.Time
+	Offenses   int
+}
+
+type rejectionWindow struct {
+	count int
+	start time.Time
+}
+
+type offenseRecord struct {
+	count   int
+	lastBan time.Time
+}
+
+// PenaltyBox bans identifiers that keep getting rejected. While banned, an
+// identifier is rejected without consulting the wrapped limiter.
+type PenaltyBox struct {
+	limiter      *Ratelimiter
+	config       PenaltyConfig
+	timeProvider strategies.TimeProvider
+
+	mu         sync.Mutex
+	rejections map[string]rejectionWindow
+	offenses   map[string]offenseRecord
+	bans       map[string]Ban
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+}
+
+func NewPenaltyBox(limiter *Ratelimiter, config PenaltyConfig, timeProvider strategies.TimeProvider) *PenaltyBox {
+	if config.ForgetAfter <= 0 {
+		config.ForgetAfter = 24 * time.Hour
+	}
+
+	p := &PenaltyBox{
+		limiter:      limiter,
+		config:       config,
+		timeProvider: timeProvider,
+		rejections:   map[string]rejectionWindow{},
+		offenses:     map[string]offenseRecord{},
+		bans:         map[string]Ban{},
+		stopCleanup:  make(chan struct{}),
+		cleanupDone:  make(chan struct{}),
+	}
+
+	go p.startCleanup()
+	return p
+}
+
+func (p *PenaltyBox) IsRequestAllowed(identifier string) (bool, int) {
+	decision := p.Decide(identifier)
+	return decision.Allowed, decision.Remaining
+}
+
+func (p *PenaltyBox) Decide(identifier string) Decision {
+	decision, err := p.Allow(context.Background(), identifier)
+	if err != nil {
+		return Decision{Allowed: false, Remaining: 0, Source: SourceStrategy}
+	}
+	return decision
+}
+
+// Allow rejects banned identifiers without asking the limiter. Limiter
+// errors are returned as is and do not count as rejections.
+func (p *PenaltyBox) Allow(ctx context.Context, identifier string) (Decision, error) {
+	now := p.timeProvider.Now()
+
+	p.mu.Lock()
+	if ban, banned := p.bans[identifier]; banned {
+		if now.Before(ban.Until) {
+			p.mu.Unlock()
+			return Decision{Allowed: false, Remaining: 0, Source: SourcePenaltyBox, RetryAt: ban.Until}, nil
+		}
+		delete(p.bans, identifier)
+	}
+	p.mu.Unlock()
+
+	decision, err := p.limiter.Allow(ctx, identifier)
+	if err != nil {
+		return Decision{}, err
+	}
+	if !decision.Allowed && decision.Source == SourceStrategy {
+		p.recordRejection(identifier, now)
+	}
+	return decision, nil
+}
+
+func (p *PenaltyBox) recordRejection(identifier string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	window, exists := p.rejections[identifier]
+	if !exists || now.Sub(window.start) >= p.config.Window {
+		window = rejectionWindow{start: now}
+	}
+	window.count++
+
+	if window.count < p.config.Threshold {
+		p.rejections[identifier] = window
+		return
+	}
+
+	delete(p.rejections, identifier)
+	offense := p.offenses[identifier]
+	if now.Sub(offense.lastBan) > p.config.ForgetAfter {
+		offense = offenseRecord{}
+	}
+	offense.count++
+	offense.lastBan = now
+	p.offenses[identifier] = offense
+
+	p.bans[identifier] = Ban{
+		Identifier: identifier,
+		Until:      now.Add(p.banDuration(offense.count)),
+		Offenses:   offense.count,
+	}
+}
+
+func (p *PenaltyBox) banDuration(offenses int) time.Duration {
+	duration := p.config.BanDuration
+	for i := 1; i < offenses && p.config.Multiplier > 1; i++ {
+		duration = time.Duration(float64(duration) * p.config.Multiplier)
+		if p.config.MaxBanDuration > 0 && duration >= p.config.MaxBanDuration {
+			return p.config.MaxBanDuration
+		}
+	}
+	return duration
+}
+
+// Unban lifts a ban and forgets the identifier's previous offenses.
+func (p *PenaltyBox) Unban(identifier string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.bans, identifier)
+	delete(p.rejections, identifier)
+	delete(p.offenses, identifier)
+}
+
+func (p *PenaltyBox) Bans() []Ban {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.timeProvider.Now()
+	bans := make([]Ban, 0, len(p.bans))
+	for _, ban := range p.bans {
+		if now.Before(ban.Until) {
+			bans = append(bans, ban)
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Identifier < bans[j].Identifier
+	})
+	return bans
+}
+
+func (p *PenaltyBox) Stop() {
+	close(p.stopCleanup)
+	<-p.cleanupDone
+	p.limiter.Stop()
+}
+
+func (p *PenaltyBox) startCleanup() {
+	ticker := clock.From(p.timeProvider).NewTicker(max(p.config.Window, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			p.cleanup()
+		case <-p.stopCleanup:
+			close(p.cleanupDone)
+			return
+		}
+	}
+}
+
+func (p *PenaltyBox) cleanup() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.timeProvider.Now()
+	for identifier, window := range p.rejections {
+		if now.Sub(window.start) >= p.config.Window {
+			delete(p.rejections, identifier)
+		}
+	}
+	for identifier, ban := range p.bans {
+		if !now.Before(ban.Until) {
+			delete(p.bans, identifier)
+		}
+	}
+	for identifier, offense := range p.offenses {
+		if now.Sub(offense.lastBan) > p.config.ForgetAfter {
+			delete(p.offenses, identifier)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestPenaltyBox(config PenaltyConfig) (*PenaltyBox, *MockTimeProvider) {
+	mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	rl := NewRateLimiter(1, time.Minute, mockTimeProvider, "fixed_window")
+	return NewPenaltyBox(rl, config, mockTimeProvider), mockTimeProvider
+}
+
+func TestPenaltyBox(t *testing.T) {
+	t.Run("bans after too many rejections", func(t *testing.T) {
+		box, mockTimeProvider := newTestPenaltyBox(PenaltyConfig{Threshold: 3, Window: time.Minute, BanDuration: 10 * time.Minute})
+		defer box.Stop()
+
+		for range 4 {
+			box.Decide("ege")
+		}
+
+		decision := box.Decide("ege")
+		if decision.Allowed || decision.Source != SourcePenaltyBox {
+			t.Errorf("expected rejection by the penalty box got %+v", decision)
+		}
+
+		mockTimeProvider.Advance(5 * time.Minute)
+		if decision := box.Decide("ege"); decision.Source != SourcePenaltyBox {
+			t.Errorf("ban should outlast the rate limit window got %+v", decision)
+		}
+
+		mockTimeProvider.Advance(5 * time.Minute)
+		if decision := box.Decide("ege"); !decision.Allowed {
+			t.Errorf("ban should expire got %+v", decision)
+		}
+	})
+
+	t.Run("does not ban below the threshold", func(t *testing.T) {
+		box, _ := newTestPenaltyBox(PenaltyConfig{Threshold: 3, Window: time.Minute, BanDuration: 10 * time.Minute})
+		defer box.Stop()
+
+		for range 3 {
+			box.Decide("ege")
+		}
+
+		if len(box.Bans()) != 0 {
+			t.Errorf("expected no bans got %v", box.Bans())
+		}
+	})
+
+	t.Run("repeat offenders get longer bans", func(t *testing.T) {
+		box, mockTimeProvider := newTestPenaltyBox(PenaltyConfig{
+			Threshold:      1,
+			Window:         time.Minute,
+			BanDuration:    time.Minute,
+			Multiplier:     2,
+			MaxBanDuration: 3 * time.Minute,
+		})
+		defer box.Stop()
+
+		expected := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}
+		for _, duration := range expected {
+			mockTimeProvider.Advance(time.Hour)
+			box.Decide("ege")
+			box.Decide("ege")
+
+			bans := box.Bans()
+			if len(bans) != 1 {
+				t.Fatalf("expected 1 ban got %v", bans)
+			}
+			if got := bans[0].Until.Sub(mockTimeProvider.Now()); got != duration {
+				t.Errorf("expected ban of %v got %v", duration, got)
+			}
+		}
+	})
+
+	t.Run("manual unban", func(t *testing.T) {
+		box, _ := newTestPenaltyBox(PenaltyConfig{Threshold: 2, Window: time.Minute, BanDuration: time.Hour})
+		defer box.Stop()
+
+		for range 3 {
+			box.Decide("ege")
+			box.Decide("other")
+		}
+
+		if bans := box.Bans(); len(bans) != 2 || bans[0].Identifier != "ege" || bans[1].Identifier != "other" {
+			t.Fatalf("expected ege and other to be banned got %v", bans)
+		}
+
+		box.Unban("ege")
+
+		if decision := box.Decide("ege"); decision.Source == SourcePenaltyBox {
+			t.Errorf("unbanned identifier should reach the strategy got %+v", decision)
+		}
+		if bans := box.Bans(); len(bans) != 1 {
+			t.Errorf("expected 1 remaining ban got %v", bans)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+// PriorityClass reserves Share of the limit for its requests. Classes are
+// listed from the highest priority to the lowest.
+type PriorityClass struct {
+	Name  string
+	Share float64
+}
+
+// PriorityStrategy splits a limit between priority classes. A request may
+// use anything except the unused reservations of higher classes, so every
+// class keeps its reserved share and borrows what lower classes leave
+// unused. The lowest classes are shed first as the limit runs out.
+//
+// Like the limit itself, reservations apply per identifier: with a limit of
+// 1000 and a 10% class, every identifier keeps 100 requests for that class.
+// To split one limit shared by all clients, decide every request under the
+// same identifier, as the middleware does with a constant KeyFunc.
+type PriorityStrategy struct {
+	mu      sync.Mutex
+	total   RateLimitStrategy
+	classes []PriorityClass
+	// reserved tracks how much of each class's reservation is used, nil for
+	// classes without one.
+	reserved []RateLimitStrategy
+}
+
+// NewPriorityStrategy builds the registered strategy once for the whole
+// limit and once per class for its reservation.
+func NewPriorityStrategy(strategyName string, limit int, windowSize time.Duration, classes []PriorityClass, timeProvider strategies.TimeProvider) (*PriorityStrategy, error) {
+	definition, err := LookupStrategy(strategyName)
+	if err != nil {
+		return nil, err
+	}
+	return newPriorityStrategy(definition, limit, windowSize, nil, classes, timeProvider)
+}
+
+func newPriorityStrategy(definition StrategyDefinition, limit int, windowSize time.Duration, params map[string]any, classes []PriorityClass, timeProvider strategies.TimeProvider) (*PriorityStrategy, error) {
+	if err := validatePriorityClasses(classes); err != nil {
+		return nil, err
+	}
+
+	total, err := definition.Build(strategyParams(definition, limit, windowSize, params), timeProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PriorityStrategy{total: total, classes: classes, reserved: make([]RateLimitStrategy, len(classes))}
+	for i, class := range classes {
+		share := int(math.Floor(class.Share * float64(limit)))
+		if share == 0 {
+			continue
+		}
+		if p.reserved[i], err = definition.Build(strategyParams(definition, share, windowSize, params), timeProvider); err != nil {
+			p.Stop()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func validatePriorityClasses(classes []PriorityClass) error {
+	if len(classes) == 0 {
+		return errors.New("at least one priority class is required")
+	}
+
+	seen := map[string]bool{}
+	total := 0.0
+	for _, class := range classes {
+		if class.Name == "" || seen[class.Name] {
+			return fmt.Errorf("priority class names must be unique and not empty, got %q", class.Name)
+		}
+		if class.Share < 0 {
+			return fmt.Errorf("priority class %q has a negative share", class.Name)
+		}
+		seen[class.Name] = true
+		total += class.Share
+	}
+	if total > 1 {
+		return fmt.Errorf("priority class shares add up to %v, more than the whole limit", total)
+	}
+	return nil
+}
+
+// AllowPriority decides a request of the named class. Unknown classes are
+// treated as the lowest one.
+func (p *PriorityStrategy) AllowPriority(identifier string, class string) (bool, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.classIndex(class)
+	available := p.available(identifier, i)
+	if available <= 0 {
+		return false, 0
+	}
+	if allowed, _ := p.total.IsRequestAllowed(identifier); !allowed {
+		return false, 0
+	}
+	if p.reserved[i] != nil {
+		// Once the reservation is used up the class borrows, which the
+		// total already accounts for.
+		p.reserved[i].IsRequestAllowed(identifier)
+	}
+	return true, available - 1
+}
+
+// available is what class i may still use: the total remaining minus the
+// unused reservations of the classes above it.
+func (p *PriorityStrategy) available(identifier string, i int) int {
+	_, remaining := p.total.Peek(identifier)
+	for _, reserved := range p.reserved[:i] {
+		if reserved == nil {
+			continue
+		}
+		_, unused := reserved.Peek(identifier)
+		remaining -= unused
+	}
+	return remaining
+}
+
+func (p *PriorityStrategy) classIndex(class string) int {
+	for i, c := range p.classes {
+		if c.Name == class {
+			return i
+		}
+	}
+	return len(p.classes) - 1
+}
+
+// IsRequestAllowed decides requests without a class as the lowest one.
+func (p *PriorityStrategy) IsRequestAllowed(identifier string) (bool, int) {
+	return p.AllowPriority(identifier, "")
+}
+
+func (p *PriorityStrategy) Peek(identifier string) (bool, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	available := max(p.available(identifier, len(p.classes)-1), 0)
+	return available > 0, available
+}
+
+func (p *PriorityStrategy) Reset(identifier string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total.Reset(identifier)
+	for _, reserved := range p.reserved {
+		if reserved != nil {
+			reserved.Reset(identifier)
+		}
+	}
+}
+
+// Grant raises the shared part of the limit, which every class can use.
+func (p *PriorityStrategy) Grant(identifier string, n int) {
+	p.total.Grant(identifier, n)
+}
+
+// Refund gives back requests of the lowest class, like IsRequestAllowed
+// decides them.
+func (p *PriorityStrategy) Refund(identifier string, n int) {
+	p.RefundPriority(identifier, "", n)
+}
+
+// RefundPriority gives back n requests of the named class to the limit and
+// to the class's reservation. A class that borrowed beyond its reservation
+// gets the reservation back first, which lower classes only notice as
+// slightly less capacity to borrow.
+func (p *PriorityStrategy) RefundPriority(identifier string, class string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, strategy := range []RateLimitStrategy{p.total, p.reserved[p.classIndex(class)]} {
+		if refundable, ok := strategy.(RefundableStrategy); ok {
+			refundable.Refund(identifier, n)
+		}
+	}
+}
+
+func (p *PriorityStrategy) CanRefund() bool {
+	return CanRefund(p.total)
+}
+
+func (p *PriorityStrategy) Stop() {
+	p.total.Stop()
+	for _, reserved := range p.reserved {
+		if reserved != nil {
+			reserved.Stop()
+		}
+	}
+}
+
+type PriorityLimiter interface {
+	AllowPriority(ctx context.Context, identifier string, class string) (Decision, error)
+	RefundPriority(identifier string, class string, n int) error
+}
+
+// AllowPriority is Allow for a request of the named priority class. Limiters
+// without priority classes ignore the class.
+func (r *Ratelimiter) AllowPriority(ctx context.Context, identifier string, class string) (Decision, error) {
+	priority, ok := r.strategy.(*PriorityStrategy)
+	if !ok {
+		return r.Allow(ctx, identifier)
+	}
+
+	return r.allow(ctx, identifier, func(ctx context.Context, identifier string) (Decision, error) {
+		allowed, remaining := priority.AllowPriority(identifier, class)
+		return Decision{Allowed: allowed, Remaining: remaining, Source: SourceStrategy}, nil
+	})
+}
+
+// RefundPriority is Refund for requests of the named priority class, so their
+// reservation is given back as well. Limiters without priority classes ignore
+// the class.
+func (r *Ratelimiter) RefundPriority(identifier string, class string, n int) error {
+	priority, ok := r.strategy.(*PriorityStrategy)
+	if !ok {
+		return r.Refund(identifier, n)
+	}
+	if !priority.CanRefund() {
+		return fmt.Errorf("%w: %T", ErrRefundUnsupported, priority.total)
+	}
+
+	priority.RefundPriority(identifier, class, n)
+	return nil
+}
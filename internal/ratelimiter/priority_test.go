@@ -0,0 +1,170 @@
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+)
+
+var testPriorities = []PriorityClass{
+	{Name: "critical", Share: 0.2},
+	{Name: "paid", Share: 0.3},
+	{Name: "batch", Share: 0},
+}
+
+func admitPriority(t *testing.T, limiter *Ratelimiter, class string, n int) int {
+	t.Helper()
+	allowed := 0
+	for range n {
+		decision, err := limiter.AllowPriority(context.Background(), "ege", class)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if decision.Allowed {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestPriorityClasses(t *testing.T) {
+	newLimiter := func() *Ratelimiter {
+		return NewRatelimiterWithConfig(&Config{
+			Strategy:     "fixed_window",
+			Limit:        10,
+			WindowSize:   time.Minute,
+			TimeProvider: &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+			Priorities:   testPriorities,
+		})
+	}
+
+	t.Run("lower classes are shed before reservations", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+
+		if allowed := admitPriority(t, limiter, "batch", 10); allowed != 5 {
+			t.Errorf("expected batch to stop at the 5 unreserved requests got %d", allowed)
+		}
+		if allowed := admitPriority(t, limiter, "paid", 10); allowed != 3 {
+			t.Errorf("expected paid to get its reserved 3 got %d", allowed)
+		}
+		if allowed := admitPriority(t, limiter, "critical", 10); allowed != 2 {
+			t.Errorf("expected critical to get its reserved 2 got %d", allowed)
+		}
+	})
+
+	t.Run("higher classes borrow unused capacity", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+
+		if allowed := admitPriority(t, limiter, "critical", 20); allowed != 10 {
+			t.Errorf("expected critical to use the whole limit got %d", allowed)
+		}
+		if allowed := admitPriority(t, limiter, "batch", 1); allowed != 0 {
+			t.Errorf("expected batch to be shed got %d", allowed)
+		}
+	})
+
+	t.Run("a higher class keeps its reservation after borrowing", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+
+		// Paid uses its own 3 and borrows 5 of the unreserved capacity.
+		if allowed := admitPriority(t, limiter, "paid", 20); allowed != 8 {
+			t.Errorf("expected paid to use everything but critical's reservation got %d", allowed)
+		}
+		if allowed := admitPriority(t, limiter, "critical", 5); allowed != 2 {
+			t.Errorf("expected critical to keep its reserved 2 got %d", allowed)
+		}
+	})
+
+	t.Run("unclassified requests are the lowest class", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+
+		allowed := 0
+		for range 10 {
+			if ok, _ := limiter.IsRequestAllowed("ege"); ok {
+				allowed++
+			}
+		}
+		allowed += admitPriority(t, limiter, "unknown", 10)
+		if allowed != 5 {
+			t.Errorf("expected unclassified requests to share the 5 unreserved requests got %d", allowed)
+		}
+	})
+
+	t.Run("refunds give the reservation back", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+
+		admitPriority(t, limiter, "critical", 2)
+		if err := limiter.RefundPriority("ege", "critical", 1); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if allowed := admitPriority(t, limiter, "batch", 10); allowed != 5 {
+			t.Errorf("expected critical's refunded request to stay reserved, batch got %d", allowed)
+		}
+	})
+
+	t.Run("shadow mode and access lists apply", func(t *testing.T) {
+		limiter := newLimiter()
+		defer limiter.Stop()
+		limiter.SetShadow(true, nil)
+		list, _ := accesslist.New([]string{"partner"}, nil)
+		limiter.SetAccessList(list)
+
+		admitPriority(t, limiter, "batch", 5)
+		if decision, _ := limiter.AllowPriority(context.Background(), "ege", "batch"); !decision.Allowed || !decision.Shadowed {
+			t.Errorf("expected a shadowed rejection got %+v", decision)
+		}
+		if decision, _ := limiter.AllowPriority(context.Background(), "partner", "batch"); decision.Source != SourceAllowList {
+			t.Errorf("expected the allow list to decide got %+v", decision)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := limiter.AllowPriority(ctx, "ege", "critical"); err == nil {
+			t.Error("expected a cancelled context to be reported")
+		}
+	})
+
+	t.Run("limiters without classes ignore the class", func(t *testing.T) {
+		limiter := NewRateLimiter(1, time.Minute, &MockTimeProvider{}, "fixed_window")
+		defer limiter.Stop()
+
+		if allowed := admitPriority(t, limiter, "critical", 2); allowed != 1 {
+			t.Errorf("expected the plain limit of 1 got %d", allowed)
+		}
+	})
+
+	t.Run("invalid classes", func(t *testing.T) {
+		for name, classes := range map[string][]PriorityClass{
+			"shares over the limit": {{Name: "a", Share: 0.6}, {Name: "b", Share: 0.6}},
+			"duplicate names":       {{Name: "a", Share: 0.1}, {Name: "a", Share: 0.1}},
+			"negative share":        {{Name: "a", Share: -0.1}},
+		} {
+			if _, err := NewPriorityStrategy("fixed_window", 10, time.Minute, classes, &MockTimeProvider{}); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("config files", func(t *testing.T) {
+		configs, err := ParseConfig([]byte(`{"policies": [{"strategy": "fixed_window", "limit": 10, "window": "1m",
+			"priorities": [{"name": "critical", "share": 0.2}, {"name": "batch", "share": 0}]}]}`))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(configs[0].Priorities) != 2 || configs[0].Priorities[0] != (PriorityClass{Name: "critical", Share: 0.2}) {
+			t.Errorf("expected the priority classes to be loaded got %+v", configs[0].Priorities)
+		}
+
+		if _, err := ParseConfig([]byte(`{"policies": [{"strategy": "fixed_window", "limit": 10, "window": "1m",
+			"priorities": [{"name": "critical", "share": 2}]}]}`)); err == nil {
+			t.Error("expected shares over the limit to be rejected")
+		}
+	})
+}
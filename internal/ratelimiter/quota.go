@@ -0,0 +1,21 @@
+package ratelimiter
+
+import (
+	"fmt"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type UsageReporter interface {
+	Usage(identifier string) strategies.QuotaUsage
+}
+
+// Usage reports how much of its quota identifier has used in the current
+// calendar period.
+func (r *Ratelimiter) Usage(identifier string) (strategies.QuotaUsage, error) {
+	reporter, ok := r.strategy.(UsageReporter)
+	if !ok {
+		return strategies.QuotaUsage{}, fmt.Errorf("strategy %T does not report usage", r.strategy)
+	}
+	return reporter.Usage(identifier), nil
+}
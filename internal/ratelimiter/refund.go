@@ -0,0 +1,60 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRefundUnsupported is returned by Refund when the strategy cannot give
+// requests back.
+var ErrRefundUnsupported = errors.New("strategy does not support refunds")
+
+type RefundableStrategy interface {
+	// Refund gives back n requests identifier already consumed, for requests
+	// that turn out not to count.
+	Refund(identifier string, n int)
+}
+
+// RefundChecker is implemented by refundable strategies that wrap others and
+// can only refund if the wrapped strategies can.
+type RefundChecker interface {
+	CanRefund() bool
+}
+
+// CanRefund reports whether refunds given to strategy take effect.
+func CanRefund(strategy RateLimitStrategy) bool {
+	if _, ok := strategy.(RefundableStrategy); !ok {
+		return false
+	}
+	if checker, ok := strategy.(RefundChecker); ok {
+		return checker.CanRefund()
+	}
+	return true
+}
+
+// Refund returns n consumed requests to identifier's limit.
+func (r *Ratelimiter) Refund(identifier string, n int) error {
+	return refund(r.strategy, identifier, n)
+}
+
+func (r *Ratelimiter) CanRefund() bool {
+	return CanRefund(r.strategy)
+}
+
+// Refund lets strategies adapted with Adapt be refunded like a Ratelimiter.
+func (s inMemoryStrategy) Refund(identifier string, n int) error {
+	return refund(s.strategy, identifier, n)
+}
+
+func (s inMemoryStrategy) CanRefund() bool {
+	return CanRefund(s.strategy)
+}
+
+func refund(strategy RateLimitStrategy, identifier string, n int) error {
+	if !CanRefund(strategy) {
+		return fmt.Errorf("%w: %T", ErrRefundUnsupported, strategy)
+	}
+
+	strategy.(RefundableStrategy).Refund(identifier, n)
+	return nil
+}
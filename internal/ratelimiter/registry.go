@@ -0,0 +1,294 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+type ParamType int
+
+const (
+	ParamInt ParamType = iota
+	ParamFloat
+	ParamDuration
+	ParamString
+	ParamBool
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamFloat:
+		return "float"
+	case ParamDuration:
+		return "duration"
+	case ParamString:
+		return "string"
+	case ParamBool:
+		return "bool"
+	default:
+		return "int"
+	}
+}
+
+// Param describes one parameter a strategy factory accepts. Config's Limit
+// and WindowSize are passed as the "limit" and "window" parameters to
+// strategies that declare them.
+type Param struct {
+	Name        string
+	Type        ParamType
+	Required    bool
+	Default     any
+	Description string
+}
+
+// Params holds parameter values already converted to their declared types.
+type Params map[string]any
+
+func (p Params) Int(name string) int {
+	value, _ := p[name].(int)
+	return value
+}
+
+func (p Params) Float(name string) float64 {
+	value, _ := p[name].(float64)
+	return value
+}
+
+func (p Params) Duration(name string) time.Duration {
+	value, _ := p[name].(time.Duration)
+	return value
+}
+
+func (p Params) String(name string) string {
+	value, _ := p[name].(string)
+	return value
+}
+
+func (p Params) Bool(name string) bool {
+	value, _ := p[name].(bool)
+	return value
+}
+
+type StrategyFactory func(params Params, timeProvider strategies.TimeProvider) (RateLimitStrategy, error)
+
+type StrategyDefinition struct {
+	Name   string
+	Params []Param
+	New    StrategyFactory
+}
+
+type UnknownStrategyError struct {
+	Name       string
+	Registered []string
+}
+
+func (e *UnknownStrategyError) Error() string {
+	return fmt.Sprintf("unknown strategy %q, registered strategies: %s", e.Name, strings.Join(e.Registered, ", "))
+}
+
+var registry = struct {
+	mu          sync.RWMutex
+	definitions map[string]StrategyDefinition
+}{definitions: map[string]StrategyDefinition{}}
+
+// RegisterStrategy makes a strategy available to NewRateLimiter and config
+// files under its name. It is usually called from an init function.
+func RegisterStrategy(definition StrategyDefinition) error {
+	if definition.Name == "" || definition.New == nil {
+		return errors.New("strategy definition needs a name and a factory")
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if _, exists := registry.definitions[definition.Name]; exists {
+		return fmt.Errorf("strategy %q is already registered", definition.Name)
+	}
+	registry.definitions[definition.Name] = definition
+	return nil
+}
+
+// RegisteredStrategies returns the registered names in alphabetical order.
+func RegisteredStrategies() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	names := make([]string, 0, len(registry.definitions))
+	for name := range registry.definitions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func LookupStrategy(name string) (StrategyDefinition, error) {
+	registry.mu.RLock()
+	definition, exists := registry.definitions[name]
+	registry.mu.RUnlock()
+
+	if !exists {
+		return StrategyDefinition{}, &UnknownStrategyError{Name: name, Registered: RegisteredStrategies()}
+	}
+	return definition, nil
+}
+
+// HasParam reports whether the strategy declares the parameter.
+func (d StrategyDefinition) HasParam(name string) bool {
+	return slices.ContainsFunc(d.Params, func(param Param) bool { return param.Name == name })
+}
+
+// NewStrategy validates raw against the strategy's schema and builds it. Raw
+// values may be typed already or come from JSON, where durations are strings
+// such as "1m".
+func NewStrategy(name string, raw map[string]any, timeProvider strategies.TimeProvider) (RateLimitStrategy, error) {
+	definition, err := LookupStrategy(name)
+	if err != nil {
+		return nil, err
+	}
+	return definition.Build(raw, timeProvider)
+}
+
+func (d StrategyDefinition) Build(raw map[string]any, timeProvider strategies.TimeProvider) (RateLimitStrategy, error) {
+	params, err := d.parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %q: %w", d.Name, err)
+	}
+
+	strategy, err := d.New(params, timeProvider)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %q: %w", d.Name, err)
+	}
+	return strategy, nil
+}
+
+func (d StrategyDefinition) parse(raw map[string]any) (Params, error) {
+	for name := range raw {
+		if !d.HasParam(name) {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	params := Params{}
+	for _, param := range d.Params {
+		value, exists := raw[param.Name]
+		if !exists {
+			if param.Required {
+				return nil, fmt.Errorf("missing required parameter %q", param.Name)
+			}
+			if param.Default == nil {
+				continue
+			}
+			value = param.Default
+		}
+
+		converted, err := convertParam(param.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", param.Name, err)
+		}
+		params[param.Name] = converted
+	}
+	return params, nil
+}
+
+func convertParam(paramType ParamType, value any) (any, error) {
+	switch paramType {
+	case ParamInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	case ParamFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		}
+	case ParamDuration:
+		switch v := value.(type) {
+		case time.Duration:
+			return v, nil
+		case string:
+			return time.ParseDuration(v)
+		}
+	case ParamString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case ParamBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected %s, got %v", paramType, value)
+}
+
+func windowedStrategy(name string, build func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy) StrategyDefinition {
+	return StrategyDefinition{
+		Name: name,
+		Params: []Param{
+			{Name: "limit", Type: ParamInt, Required: true, Description: "requests per window"},
+			{Name: "window", Type: ParamDuration, Required: true, Description: "window size"},
+		},
+		New: func(p Params, tp strategies.TimeProvider) (RateLimitStrategy, error) {
+			if p.Int("limit") <= 0 || p.Duration("window") <= 0 {
+				return nil, fmt.Errorf("limit and window must be positive, got %d and %v", p.Int("limit"), p.Duration("window"))
+			}
+			return build(p.Int("limit"), p.Duration("window"), tp), nil
+		},
+	}
+}
+
+func calendarStrategy(name string, period strategies.CalendarPeriod) StrategyDefinition {
+	return StrategyDefinition{
+		Name: name,
+		Params: []Param{
+			{Name: "limit", Type: ParamInt, Required: true, Description: "requests per calendar period"},
+		},
+		New: func(p Params, tp strategies.TimeProvider) (RateLimitStrategy, error) {
+			if p.Int("limit") <= 0 {
+				return nil, fmt.Errorf("limit must be positive, got %d", p.Int("limit"))
+			}
+			return strategies.NewCalendarQuotaStrategy(p.Int("limit"), period, time.UTC, tp), nil
+		},
+	}
+}
+
+func init() {
+	for _, definition := range []StrategyDefinition{
+		windowedStrategy("fixed_window", func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy {
+			return strategies.NewFixedWindowStrategy(limit, window, tp)
+		}),
+		windowedStrategy("sliding_window_log", func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy {
+			return strategies.NewSlidingWindowLogStrategy(limit, window, tp)
+		}),
+		windowedStrategy("sliding_window_counter", func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy {
+			return strategies.NewSlidingWindowCountStrategy(limit, window, tp)
+		}),
+		windowedStrategy("token_bucket", func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy {
+			return strategies.NewTokenBucketStrategy(limit, window, tp)
+		}),
+		windowedStrategy("fair_share", func(limit int, window time.Duration, tp strategies.TimeProvider) RateLimitStrategy {
+			return strategies.NewFairShareStrategy(limit, window, tp)
+		}),
+		calendarStrategy("calendar_day", strategies.Day),
+		calendarStrategy("calendar_week", strategies.Week),
+		calendarStrategy("calendar_month", strategies.Month),
+	} {
+		if err := RegisterStrategy(definition); err != nil {
+			panic(err)
+		}
+	}
+}
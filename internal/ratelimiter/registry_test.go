@@ -0,0 +1,158 @@
+package ratelimiter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+// everyNth allows every nth request of an identifier.
+type everyNth struct {
+	n     int
+	label string
+	seen  map[string]int
+}
+
+func (e *everyNth) IsRequestAllowed(identifier string) (bool, int) {
+	e.seen[identifier]++
+	return e.seen[identifier]%e.n == 0, 0
+}
+
+func (e *everyNth) Peek(identifier string) (bool, int) { return (e.seen[identifier]+1)%e.n == 0, 0 }
+func (e *everyNth) Reset(identifier string)            { delete(e.seen, identifier) }
+func (e *everyNth) Grant(identifier string, n int)     {}
+func (e *everyNth) Stop()                              {}
+
+func init() {
+	err := RegisterStrategy(StrategyDefinition{
+		Name: "every_nth",
+		Params: []Param{
+			{Name: "n", Type: ParamInt, Required: true},
+			{Name: "label", Type: ParamString, Default: "unlabelled"},
+		},
+		New: func(params Params, timeProvider strategies.TimeProvider) (RateLimitStrategy, error) {
+			return &everyNth{n: params.Int("n"), label: params.String("label"), seen: map[string]int{}}, nil
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("builds registered strategies from config", func(t *testing.T) {
+		rl, err := NewFromConfig(&Config{Strategy: "every_nth", Params: map[string]any{"n": 2}})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer rl.Stop()
+
+		if allowed, _ := rl.IsRequestAllowed("ege"); allowed {
+			t.Error("first request should be rejected")
+		}
+		if allowed, _ := rl.IsRequestAllowed("ege"); !allowed {
+			t.Error("second request should be allowed")
+		}
+		if label := rl.strategy.(*everyNth).label; label != "unlabelled" {
+			t.Errorf("expected the default label got %q", label)
+		}
+	})
+
+	t.Run("unknown strategy lists the registered ones", func(t *testing.T) {
+		_, err := NewFromConfig(&Config{Strategy: "leaky_bucket", Limit: 1, WindowSize: time.Minute})
+
+		var unknown *UnknownStrategyError
+		if !errors.As(err, &unknown) {
+			t.Fatalf("expected an UnknownStrategyError got %v", err)
+		}
+		if !strings.Contains(err.Error(), "every_nth") || !strings.Contains(err.Error(), "token_bucket") {
+			t.Errorf("expected the registered strategies in %q", err)
+		}
+	})
+
+	t.Run("validates parameters", func(t *testing.T) {
+		cases := map[string]map[string]any{
+			"missing required": {},
+			"wrong type":       {"n": "two"},
+			"fractional int":   {"n": 1.5},
+			"unknown":          {"n": 2, "m": 3},
+		}
+
+		for name, params := range cases {
+			if _, err := NewStrategy("every_nth", params, &strategies.RealTimeProvider{}); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("converts json values", func(t *testing.T) {
+		strategy, err := NewStrategy("fixed_window", map[string]any{"limit": 2.0, "window": "1m"}, &strategies.RealTimeProvider{})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer strategy.Stop()
+
+		if _, remaining := strategy.IsRequestAllowed("ege"); remaining != 1 {
+			t.Errorf("expected a limit of 2 got %d remaining", remaining)
+		}
+	})
+
+	t.Run("rejects duplicate names", func(t *testing.T) {
+		err := RegisterStrategy(StrategyDefinition{Name: "fixed_window", New: func(Params, strategies.TimeProvider) (RateLimitStrategy, error) {
+			return nil, nil
+		}})
+		if err == nil {
+			t.Error("expected registering fixed_window twice to fail")
+		}
+	})
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Run("loads built-in and custom strategies", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "policies.json")
+		os.WriteFile(path, []byte(`{"policies": [
+			{"name": "api", "strategy": "token_bucket", "limit": 100, "window": "1m", "max_keys": 10, "eviction_policy": "deny_new"},
+			{"name": "monthly", "strategy": "calendar_month", "limit": 10000, "location": "UTC"},
+			{"name": "custom", "strategy": "every_nth", "params": {"n": 3, "label": "beta"}}
+		]}`), 0o644)
+
+		configs, err := LoadConfigFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(configs) != 3 {
+			t.Fatalf("expected 3 policies got %d", len(configs))
+		}
+		if api := configs[0]; api.WindowSize != time.Minute || api.EvictionPolicy != strategies.DenyNewKeys {
+			t.Errorf("unexpected api policy %+v", api)
+		}
+
+		for _, config := range configs {
+			rl, err := NewFromConfig(config)
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", config.Name, err)
+			}
+			rl.Stop()
+		}
+	})
+
+	t.Run("reports the invalid policy", func(t *testing.T) {
+		cases := map[string]string{
+			"unknown strategy": `{"policies": [{"name": "api", "strategy": "leaky_bucket", "limit": 1}]}`,
+			"missing window":   `{"policies": [{"name": "api", "strategy": "fixed_window", "limit": 1}]}`,
+			"bad parameter":    `{"policies": [{"name": "api", "strategy": "every_nth", "params": {"n": "x"}}]}`,
+			"unknown field":    `{"policies": [{"name": "api", "strategy": "fixed_window", "limt": 1}]}`,
+		}
+
+		for name, data := range cases {
+			if _, err := ParseConfig([]byte(data)); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+}
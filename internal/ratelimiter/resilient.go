@@ -0,0 +1,363 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type FailurePolicy int
+
+const (
+	// FailClosed rejects requests while the backend is down.
+	FailClosed FailurePolicy = iota
+	// FailOpen allows requests while the backend is down.
+	FailOpen
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	// CircuitHalfOpen lets a single trial request through to the backend.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+type ResilienceConfig struct {
+	// Policy decides requests while the backend is down and there is no
+	// Fallback.
+	Policy FailurePolicy
+	// Fallback decides requests while the backend is down, usually a local
+	// strategy from NewLocalFallback.
+	Fallback RateLimitStrategy
+
+	// FailureThreshold consecutive errors open the circuit. Defaults to 5.
+	FailureThreshold int
+	// ProbeInterval is how long the circuit stays open before the backend
+	// is tried again. Defaults to 10s.
+	ProbeInterval time.Duration
+	// Probe checks the backend's health every ProbeInterval while the
+	// circuit is open. Without it a single request is let through instead.
+	Probe func(ctx context.Context) error
+	// Timeout bounds every backend call, including probes. Zero means the
+	// caller's context is the only limit.
+	Timeout time.Duration
+
+	// OnStateChange is called with the breaker locked and must not call
+	// back into the strategy.
+	OnStateChange func(from, to CircuitState)
+}
+
+type ResilienceStats struct {
+	State             CircuitState
+	BackendErrors     int64
+	DegradedDecisions int64
+	CircuitOpened     int64
+}
+
+// ResilientStrategy guards a remote strategy with a circuit breaker. Backend
+// errors never reach the caller: once the circuit is open, requests are
+// decided by the fallback or the failure policy until the backend recovers.
+type ResilientStrategy struct {
+	remote       RateLimitStrategy
+	config       ResilienceConfig
+	timeProvider strategies.TimeProvider
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+
+	backendErrors     atomic.Int64
+	degradedDecisions atomic.Int64
+	circuitOpened     atomic.Int64
+
+	stopProbe chan struct{}
+	probeDone chan struct{}
+}
+
+func NewResilientStrategy(remote RateLimitStrategy, config ResilienceConfig, timeProvider strategies.TimeProvider) *ResilientStrategy {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.ProbeInterval <= 0 {
+		config.ProbeInterval = 10 * time.Second
+	}
+
+	r := &ResilientStrategy{
+		remote:       remote,
+		config:       config,
+		timeProvider: timeProvider,
+		stopProbe:    make(chan struct{}),
+		probeDone:    make(chan struct{}),
+	}
+
+	if config.Probe != nil {
+		go r.startProbing()
+	} else {
+		close(r.probeDone)
+	}
+	return r
+}
+
+// NewLocalFallback builds a registered strategy with limit divided between
+// nodes, so the instances of a cluster together stay close to the shared
+// limit while each decides on its own.
+func NewLocalFallback(strategyName string, limit int, windowSize time.Duration, nodes int, timeProvider strategies.TimeProvider) (RateLimitStrategy, error) {
+	if nodes <= 0 {
+		return nil, fmt.Errorf("nodes must be positive, got %d", nodes)
+	}
+
+	definition, err := LookupStrategy(strategyName)
+	if err != nil {
+		return nil, err
+	}
+	return definition.Build(strategyParams(definition, max(limit/nodes, 1), windowSize, nil), timeProvider)
+}
+
+func (r *ResilientStrategy) IsRequestAllowed(identifier string) (bool, int) {
+	decision, _ := r.Allow(context.Background(), identifier)
+	return decision.Allowed, decision.Remaining
+}
+
+// Allow only returns an error if ctx is done, backend errors are absorbed.
+func (r *ResilientStrategy) Allow(ctx context.Context, identifier string) (Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return Decision{}, err
+	}
+	if !r.useBackend() {
+		return r.degraded(identifier), nil
+	}
+
+	callCtx, cancel := r.withTimeout(ctx)
+	decision, err := Adapt(r.remote).Allow(callCtx, identifier)
+	cancel()
+
+	if err == nil {
+		r.succeeded()
+		return decision, nil
+	}
+	if ctx.Err() != nil {
+		// The caller gave up, which says nothing about the backend.
+		r.abandoned()
+		return Decision{}, ctx.Err()
+	}
+
+	r.backendErrors.Add(1)
+	r.failed()
+	return r.degraded(identifier), nil
+}
+
+func (r *ResilientStrategy) Peek(identifier string) (bool, int) {
+	if !r.Degraded() {
+		return r.remote.Peek(identifier)
+	}
+	if r.config.Fallback != nil {
+		return r.config.Fallback.Peek(identifier)
+	}
+	if r.config.Policy == FailOpen {
+		return true, Unlimited
+	}
+	return false, 0
+}
+
+func (r *ResilientStrategy) Reset(identifier string) {
+	r.remote.Reset(identifier)
+	if r.config.Fallback != nil {
+		r.config.Fallback.Reset(identifier)
+	}
+}
+
+func (r *ResilientStrategy) Grant(identifier string, n int) {
+	r.remote.Grant(identifier, n)
+	if r.config.Fallback != nil {
+		r.config.Fallback.Grant(identifier, n)
+	}
+}
+
+// Refund gives back to both the backend and the fallback, like Reset and
+// Grant, as the circuit may have changed since the request was decided.
+// Strategies do not refund more than identifier consumed, so the side that
+// did not decide the request gains little.
+func (r *ResilientStrategy) Refund(identifier string, n int) {
+	for _, strategy := range []RateLimitStrategy{r.remote, r.config.Fallback} {
+		if refundable, ok := strategy.(RefundableStrategy); ok {
+			refundable.Refund(identifier, n)
+		}
+	}
+}
+
+// CanRefund reports whether the backend or the fallback supports refunds.
+func (r *ResilientStrategy) CanRefund() bool {
+	return CanRefund(r.remote) || (r.config.Fallback != nil && CanRefund(r.config.Fallback))
+}
+
+func (r *ResilientStrategy) Stop() {
+	close(r.stopProbe)
+	<-r.probeDone
+	r.remote.Stop()
+	if r.config.Fallback != nil {
+		r.config.Fallback.Stop()
+	}
+}
+
+// Degraded reports whether requests are currently decided without the
+// backend.
+func (r *ResilientStrategy) Degraded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state != CircuitClosed
+}
+
+func (r *ResilientStrategy) Stats() ResilienceStats {
+	r.mu.Lock()
+	state := r.state
+	r.mu.Unlock()
+
+	return ResilienceStats{
+		State:             state,
+		BackendErrors:     r.backendErrors.Load(),
+		DegradedDecisions: r.degradedDecisions.Load(),
+		CircuitOpened:     r.circuitOpened.Load(),
+	}
+}
+
+func (r *ResilientStrategy) degraded(identifier string) Decision {
+	r.degradedDecisions.Add(1)
+
+	if r.config.Fallback != nil {
+		allowed, remaining := r.config.Fallback.IsRequestAllowed(identifier)
+		return Decision{Allowed: allowed, Remaining: remaining, Source: SourceStrategy, Degraded: true}
+	}
+	if r.config.Policy == FailOpen {
+		return Decision{Allowed: true, Remaining: Unlimited, Source: SourceStrategy, Degraded: true}
+	}
+	return Decision{Allowed: false, Remaining: 0, Source: SourceStrategy, Degraded: true}
+}
+
+// useBackend reports whether the request may go to the backend, moving an
+// open circuit to half-open once ProbeInterval has passed.
+func (r *ResilientStrategy) useBackend() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if r.config.Probe != nil || r.timeProvider.Now().Sub(r.openedAt) < r.config.ProbeInterval {
+			return false
+		}
+		r.setState(CircuitHalfOpen)
+		return true
+	default:
+		// A trial request is already in flight.
+		return false
+	}
+}
+
+func (r *ResilientStrategy) succeeded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = 0
+	r.setState(CircuitClosed)
+}
+
+func (r *ResilientStrategy) failed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures++
+	if r.state == CircuitHalfOpen || (r.state == CircuitClosed && r.failures >= r.config.FailureThreshold) {
+		r.openedAt = r.timeProvider.Now()
+		r.circuitOpened.Add(1)
+		r.setState(CircuitOpen)
+	}
+}
+
+// abandoned puts a half-open circuit back to open without counting a
+// failure, so the next request becomes the trial.
+func (r *ResilientStrategy) abandoned() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == CircuitHalfOpen {
+		r.setState(CircuitOpen)
+	}
+}
+
+func (r *ResilientStrategy) setState(state CircuitState) {
+	if r.state == state {
+		return
+	}
+	from := r.state
+	r.state = state
+	if r.config.OnStateChange != nil {
+		r.config.OnStateChange(from, state)
+	}
+}
+
+func (r *ResilientStrategy) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.config.Timeout > 0 {
+		return context.WithTimeout(ctx, r.config.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (r *ResilientStrategy) startProbing() {
+	defer close(r.probeDone)
+	ticker := clock.From(r.timeProvider).NewTicker(r.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			r.probe()
+		case <-r.stopProbe:
+			return
+		}
+	}
+}
+
+func (r *ResilientStrategy) probe() {
+	if !r.Degraded() {
+		return
+	}
+
+	ctx, cancel := r.withTimeout(context.Background())
+	defer cancel()
+	if err := r.config.Probe(ctx); err == nil {
+		r.succeeded()
+	}
+}
+
+type DegradableStrategy interface {
+	Degraded() bool
+}
+
+// Degraded reports whether the strategy currently decides without its
+// backend.
+func (r *Ratelimiter) Degraded() bool {
+	if degradable, ok := r.strategy.(DegradableStrategy); ok {
+		return degradable.Degraded()
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func newRemote(limit int, timeProvider strategies.TimeProvider) *remoteStrategy {
+	return &remoteStrategy{FixedWindowStrategy: strategies.NewFixedWindowStrategy(limit, time.Minute, timeProvider)}
+}
+
+func TestResilientStrategy(t *testing.T) {
+	t.Run("fails closed once the circuit opens", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(100, mockTimeProvider)
+		remote.err = errBackendDown
+		strategy := NewResilientStrategy(remote, ResilienceConfig{Policy: FailClosed, FailureThreshold: 2}, mockTimeProvider)
+		defer strategy.Stop()
+
+		for range 3 {
+			decision, err := strategy.Allow(context.Background(), "ege")
+			if err != nil || decision.Allowed || !decision.Degraded {
+				t.Errorf("expected a degraded rejection got %+v %v", decision, err)
+			}
+		}
+
+		stats := strategy.Stats()
+		if stats.State != CircuitOpen || stats.BackendErrors != 2 || stats.DegradedDecisions != 3 || stats.CircuitOpened != 1 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("fails open", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(100, mockTimeProvider)
+		remote.err = errBackendDown
+		strategy := NewResilientStrategy(remote, ResilienceConfig{Policy: FailOpen, FailureThreshold: 1}, mockTimeProvider)
+		defer strategy.Stop()
+
+		if allowed, remaining := strategy.IsRequestAllowed("ege"); !allowed || remaining != Unlimited {
+			t.Errorf("expected an unlimited allow got %t %d", allowed, remaining)
+		}
+		if !strategy.Degraded() {
+			t.Error("strategy should report degraded mode")
+		}
+	})
+
+	t.Run("falls back to a scaled local limit", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(10, mockTimeProvider)
+		remote.err = errBackendDown
+		fallback, err := NewLocalFallback("fixed_window", 10, time.Minute, 2, mockTimeProvider)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		strategy := NewResilientStrategy(remote, ResilienceConfig{Fallback: fallback, FailureThreshold: 1}, mockTimeProvider)
+		defer strategy.Stop()
+
+		allowed := 0
+		for range 10 {
+			if decision, _ := strategy.Allow(context.Background(), "ege"); decision.Allowed {
+				allowed++
+			}
+		}
+		if allowed != 5 {
+			t.Errorf("expected half of the limit on each of 2 nodes got %d", allowed)
+		}
+	})
+
+	t.Run("half-open trial closes the circuit", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(100, mockTimeProvider)
+		remote.err = errBackendDown
+
+		var transitions []CircuitState
+		strategy := NewResilientStrategy(remote, ResilienceConfig{
+			FailureThreshold: 1,
+			ProbeInterval:    10 * time.Second,
+			OnStateChange: func(from, to CircuitState) {
+				transitions = append(transitions, to)
+			},
+		}, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("ege")
+		mockTimeProvider.Advance(10 * time.Second)
+		// The trial fails and the circuit opens again.
+		strategy.IsRequestAllowed("ege")
+
+		remote.err = nil
+		strategy.IsRequestAllowed("ege")
+		if !strategy.Degraded() {
+			t.Error("circuit should stay open until the next probe interval")
+		}
+
+		mockTimeProvider.Advance(10 * time.Second)
+		if decision, _ := strategy.Allow(context.Background(), "ege"); !decision.Allowed || decision.Degraded {
+			t.Errorf("trial should reach the recovered backend got %+v", decision)
+		}
+		if strategy.Degraded() {
+			t.Error("successful trial should close the circuit")
+		}
+
+		expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+		if len(transitions) != len(expected) {
+			t.Fatalf("expected transitions %v got %v", expected, transitions)
+		}
+		for i := range expected {
+			if transitions[i] != expected[i] {
+				t.Errorf("expected transitions %v got %v", expected, transitions)
+				break
+			}
+		}
+	})
+
+	t.Run("health probe closes the circuit", func(t *testing.T) {
+		fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		remote := newRemote(100, fakeClock)
+		remote.err = errBackendDown
+
+		healthy := make(chan error, 1)
+		strategy := NewResilientStrategy(remote, ResilienceConfig{
+			FailureThreshold: 1,
+			ProbeInterval:    time.Second,
+			Probe: func(ctx context.Context) error {
+				return <-healthy
+			},
+		}, fakeClock)
+
+		strategy.IsRequestAllowed("ege")
+		remote.err = nil
+		// The remote's cleanup ticker and the probe ticker.
+		fakeClock.BlockUntil(2)
+
+		healthy <- nil
+		fakeClock.Advance(time.Second)
+		// Stop waits for the probe the tick started.
+		strategy.Stop()
+
+		if strategy.Degraded() {
+			t.Error("healthy probe should close the circuit")
+		}
+	})
+
+	t.Run("cancelled callers do not count as backend failures", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(100, mockTimeProvider)
+		strategy := NewResilientStrategy(remote, ResilienceConfig{FailureThreshold: 1}, mockTimeProvider)
+		defer strategy.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := strategy.Allow(ctx, "ege"); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled got %v", err)
+		}
+		if strategy.Stats().BackendErrors != 0 || strategy.Degraded() {
+			t.Errorf("unexpected stats %+v", strategy.Stats())
+		}
+	})
+
+	t.Run("refunds reach the fallback after the circuit closed", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(10, mockTimeProvider)
+		remote.err = errBackendDown
+		fallback, err := NewLocalFallback("fixed_window", 1, time.Minute, 1, mockTimeProvider)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		strategy := NewResilientStrategy(remote, ResilienceConfig{Fallback: fallback, FailureThreshold: 1, ProbeInterval: 10 * time.Second}, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("ege")
+		remote.err = nil
+		mockTimeProvider.Advance(10 * time.Second)
+		strategy.IsRequestAllowed("ege")
+		if strategy.Degraded() {
+			t.Fatal("expected the circuit to close")
+		}
+
+		strategy.Refund("ege", 1)
+		if allowed, _ := fallback.Peek("ege"); !allowed {
+			t.Error("expected the request decided by the fallback to be refunded to it")
+		}
+	})
+
+	t.Run("limiter reports degraded mode", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		remote := newRemote(100, mockTimeProvider)
+		remote.err = errBackendDown
+		rl := NewRateLimiterWithStrategy(NewResilientStrategy(remote, ResilienceConfig{FailureThreshold: 1}, mockTimeProvider))
+		defer rl.Stop()
+
+		if _, err := rl.Allow(context.Background(), "ege"); err != nil {
+			t.Errorf("backend errors should be absorbed got %v", err)
+		}
+		if !rl.Degraded() {
+			t.Error("limiter should report degraded mode")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package ratelimiter
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// ShadowObserver is told about every request that shadow mode let through
+// although it would have been rejected.
+type ShadowObserver func(identifier string, decision Decision)
+
+type shadowMode struct {
+	observer   ShadowObserver
+	rejections atomic.Int64
+}
+
+// SetShadow switches the limiter to shadow mode: decisions are still made and
+// counted, but every request is allowed. Shadowed rejections are reported to
+// observer, which may be nil, and counted in ShadowRejections.
+func (r *Ratelimiter) SetShadow(enabled bool, observer ShadowObserver) {
+	if !enabled {
+		r.shadow.Store(nil)
+		return
+	}
+	r.shadow.Store(&shadowMode{observer: observer})
+}
+
+func (r *Ratelimiter) ShadowRejections() int64 {
+	shadow := r.shadow.Load()
+	if shadow == nil {
+		return 0
+	}
+	return shadow.rejections.Load()
+}
+
+func (s *shadowMode) apply(identifier string, decision Decision) Decision {
+	if decision.Allowed {
+		return decision
+	}
+
+	decision.Allowed = true
+	decision.Shadowed = true
+	s.rejections.Add(1)
+	if s.observer != nil {
+		s.observer(identifier, decision)
+	}
+	return decision
+}
+
+func ShadowLogger(logger *slog.Logger, policy string) ShadowObserver {
+	return func(identifier string, decision Decision) {
+		logger.Info("rate limit would reject request",
+			"policy", policy,
+			"identifier", identifier,
+			"source", decision.Source.String(),
+		)
+	}
+}
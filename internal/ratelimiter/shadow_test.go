@@ -0,0 +1,92 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+)
+
+func TestShadowMode(t *testing.T) {
+	t.Run("lets rejected requests through and reports them", func(t *testing.T) {
+		rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		var observed []string
+		rl.SetShadow(true, func(identifier string, decision Decision) {
+			observed = append(observed, identifier)
+		})
+
+		first := rl.Decide("ege")
+		second := rl.Decide("ege")
+
+		if !first.Allowed || first.Shadowed {
+			t.Errorf("first request should be allowed normally got %+v", first)
+		}
+		if !second.Allowed || !second.Shadowed {
+			t.Errorf("second request should be shadowed got %+v", second)
+		}
+		if len(observed) != 1 || observed[0] != "ege" {
+			t.Errorf("expected one observed rejection for ege got %v", observed)
+		}
+		if rl.ShadowRejections() != 1 {
+			t.Errorf("expected 1 shadow rejection got %d", rl.ShadowRejections())
+		}
+	})
+
+	t.Run("enforces again once disabled", func(t *testing.T) {
+		rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		rl.SetShadow(true, nil)
+		rl.Decide("ege")
+		rl.SetShadow(false, nil)
+
+		if allowed, _ := rl.IsRequestAllowed("ege"); allowed {
+			t.Error("request should be rejected after shadow mode is disabled")
+		}
+	})
+
+	t.Run("can be switched while requests are decided", func(t *testing.T) {
+		rl := NewRateLimiter(1, time.Minute, &MockTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		list, _ := accesslist.New([]string{"trusted"}, nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := range 100 {
+				rl.SetShadow(i%2 == 0, nil)
+				rl.SetAccessList(list)
+			}
+		}()
+		for range 100 {
+			rl.IsRequestAllowed("ege")
+			rl.ShadowRejections()
+		}
+		<-done
+	})
+
+	t.Run("logs would-be rejections", func(t *testing.T) {
+		var buf bytes.Buffer
+		config := &Config{
+			Strategy:       "fixed_window",
+			Limit:          1,
+			WindowSize:     time.Minute,
+			Shadow:         true,
+			ShadowObserver: ShadowLogger(slog.New(slog.NewTextHandler(&buf, nil)), "api"),
+		}
+		rl := NewRatelimiterWithConfig(config)
+		defer rl.Stop()
+
+		rl.Decide("ege")
+		rl.Decide("ege")
+
+		if !strings.Contains(buf.String(), "policy=api identifier=ege source=strategy") {
+			t.Errorf("expected shadow rejection to be logged got %q", buf.String())
+		}
+	})
+}
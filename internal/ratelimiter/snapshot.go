@@ -0,0 +1,180 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+const snapshotVersion = 1
+
+// StatefulStrategy is implemented by strategies whose per-identifier state
+// can be written to and restored from a snapshot.
+type StatefulStrategy interface {
+	SaveState() ([]byte, error)
+	LoadState(data []byte) error
+}
+
+type snapshot struct {
+	Version  int             `json:"version"`
+	Strategy string          `json:"strategy"`
+	SavedAt  time.Time       `json:"saved_at"`
+	State    json.RawMessage `json:"state"`
+}
+
+type persistence struct {
+	path       string
+	interval   time.Duration
+	onError    func(err error)
+	stopSaving chan struct{}
+	savingDone chan struct{}
+}
+
+func (r *Ratelimiter) SaveSnapshot(path string) error {
+	stateful, err := r.stateful()
+	if err != nil {
+		return err
+	}
+
+	state, err := stateful.SaveState()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot{
+		Version:  snapshotVersion,
+		Strategy: r.strategyName,
+		SavedAt:  r.clock().Now(),
+		State:    state,
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot restores the state saved by SaveSnapshot. Entries that expired
+// since the snapshot was taken are dropped by the strategy.
+func (r *Ratelimiter) LoadSnapshot(path string) error {
+	stateful, err := r.stateful()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+	if snap.Version < 1 || snap.Version > snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	if snap.Strategy != r.strategyName {
+		return fmt.Errorf("snapshot was taken with strategy %q, limiter uses %q", snap.Strategy, r.strategyName)
+	}
+
+	return stateful.LoadState(snap.State)
+}
+
+// EnablePersistence restores the snapshot at path if there is one, then saves
+// a new snapshot every interval and once more on Stop. Persistence is not
+// enabled if the snapshot cannot be restored, so a snapshot of a newer
+// version or another strategy is never overwritten. Errors of periodic saves
+// are logged with slog.
+func (r *Ratelimiter) EnablePersistence(path string, interval time.Duration) error {
+	return r.enablePersistence(path, interval, nil)
+}
+
+func (r *Ratelimiter) enablePersistence(path string, interval time.Duration, onError func(err error)) error {
+	if _, err := r.stateful(); err != nil {
+		return err
+	}
+	if err := r.LoadSnapshot(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("restoring snapshot %s: %w", path, err)
+	}
+
+	if onError == nil {
+		onError = func(err error) {
+			slog.Error("saving rate limiter snapshot", "path", path, "error", err)
+		}
+	}
+	r.persistence = &persistence{
+		path:       path,
+		interval:   interval,
+		onError:    onError,
+		stopSaving: make(chan struct{}),
+		savingDone: make(chan struct{}),
+	}
+	go r.startSaving()
+	return nil
+}
+
+func (r *Ratelimiter) startSaving() {
+	defer close(r.persistence.savingDone)
+	if r.persistence.interval <= 0 {
+		<-r.persistence.stopSaving
+		return
+	}
+
+	ticker := r.clock().NewTicker(r.persistence.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := r.SaveSnapshot(r.persistence.path); err != nil {
+				r.persistence.onError(err)
+			}
+		case <-r.persistence.stopSaving:
+			return
+		}
+	}
+}
+
+func (r *Ratelimiter) stopPersistence() {
+	if r.persistence == nil {
+		return
+	}
+
+	close(r.persistence.stopSaving)
+	<-r.persistence.savingDone
+	if err := r.SaveSnapshot(r.persistence.path); err != nil {
+		r.persistence.onError(err)
+	}
+}
+
+func (r *Ratelimiter) clock() clock.Clock {
+	return clock.From(r.timeProvider)
+}
+
+func (r *Ratelimiter) stateful() (StatefulStrategy, error) {
+	stateful, ok := r.strategy.(StatefulStrategy)
+	if !ok {
+		return nil, fmt.Errorf("strategy %T does not support snapshots", r.strategy)
+	}
+	return stateful, nil
+}
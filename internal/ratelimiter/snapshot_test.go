@@ -0,0 +1,150 @@
+package ratelimiter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Run("restores quotas after a restart", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+		rl := NewRateLimiter(2, time.Hour, mockTimeProvider, "fixed_window")
+		if err := rl.EnablePersistence(path, 0); err != nil {
+			t.Fatalf("EnablePersistence failed: %v", err)
+		}
+		rl.IsRequestAllowed("ege")
+		rl.IsRequestAllowed("ege")
+		rl.Stop()
+
+		restarted := NewRateLimiter(2, time.Hour, mockTimeProvider, "fixed_window")
+		defer restarted.Stop()
+		if err := restarted.EnablePersistence(path, 0); err != nil {
+			t.Fatalf("EnablePersistence failed: %v", err)
+		}
+
+		if allowed, _ := restarted.IsRequestAllowed("ege"); allowed {
+			t.Error("quota should survive the restart")
+		}
+	})
+
+	t.Run("missing snapshot starts empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+
+		rl := NewRateLimiter(2, time.Hour, &MockTimeProvider{}, "sliding_window_log")
+		defer rl.Stop()
+
+		if err := rl.EnablePersistence(path, 0); err != nil {
+			t.Errorf("missing snapshot should not be an error got %v", err)
+		}
+	})
+
+	t.Run("saves periodically", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+
+		rl := NewRateLimiter(2, time.Hour, &MockTimeProvider{}, "token_bucket")
+		defer rl.Stop()
+		rl.EnablePersistence(path, 10*time.Millisecond)
+		rl.IsRequestAllowed("ege")
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("snapshot was not written periodically")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("rejects unknown versions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+		os.WriteFile(path, []byte(`{"version": 99, "strategy": "fixed_window", "state": {}}`), 0o644)
+
+		rl := NewRateLimiter(2, time.Hour, &MockTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		if err := rl.LoadSnapshot(path); err == nil {
+			t.Error("expected an error for an unsupported version")
+		}
+	})
+
+	t.Run("rejects snapshots of another strategy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+
+		rl := NewRateLimiter(2, time.Hour, &MockTimeProvider{}, "fixed_window")
+		rl.SaveSnapshot(path)
+		rl.Stop()
+
+		other := NewRateLimiter(2, time.Hour, &MockTimeProvider{}, "sliding_window_log")
+		defer other.Stop()
+
+		if err := other.LoadSnapshot(path); err == nil {
+			t.Error("expected an error for a snapshot of another strategy")
+		}
+	})
+	t.Run("config rejects strategies without snapshots", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+
+		rl, err := NewFromConfig(&Config{Strategy: "fair_share", Limit: 2, WindowSize: time.Hour, SnapshotPath: path})
+		if err == nil {
+			rl.Stop()
+			t.Error("expected an error for a strategy without snapshots")
+		}
+	})
+
+	t.Run("config refuses to overwrite snapshots it cannot restore", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ratelimiter.json")
+		newer := []byte(`{"version": 99, "strategy": "fixed_window", "state": {}}`)
+		os.WriteFile(path, newer, 0o644)
+
+		rl, err := NewFromConfig(&Config{Strategy: "fixed_window", Limit: 2, WindowSize: time.Hour, SnapshotPath: path})
+		if err == nil {
+			rl.Stop()
+			t.Fatal("expected an error for a snapshot that cannot be restored")
+		}
+		if data, _ := os.ReadFile(path); string(data) != string(newer) {
+			t.Errorf("expected the snapshot to be left alone got %s", data)
+		}
+	})
+
+	t.Run("periodic saves follow the clock and report errors", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "ratelimiter.json")
+		fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		errs := make(chan error, 2)
+
+		rl, err := NewFromConfig(&Config{
+			Strategy:         "fixed_window",
+			Limit:            2,
+			WindowSize:       time.Hour,
+			TimeProvider:     fakeClock,
+			SnapshotPath:     path,
+			SnapshotInterval: time.Minute,
+			OnSnapshotError:  func(err error) { errs <- err },
+		})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer rl.Stop()
+
+		// The strategy's cleanup and the snapshots each wait on a ticker.
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(time.Minute)
+		select {
+		case err := <-errs:
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected the missing directory to be reported got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected the failed save to be reported")
+		}
+	})
+}
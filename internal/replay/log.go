@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+type Entry struct {
+	Time time.Time
+	Key  string
+}
+
+// Parser reads Common and Combined Log Format lines, keyed by the remote
+// host, and JSON lines, keyed by KeyField.
+type Parser struct {
+	// TimeField holds an RFC 3339 string or Unix seconds. Defaults to "time".
+	TimeField string
+	// KeyField defaults to "remote_addr".
+	KeyField string
+}
+
+var errEmptyLine = errors.New("empty line")
+
+func (p *Parser) ParseLine(line string) (Entry, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return Entry{}, errEmptyLine
+	}
+	if strings.HasPrefix(line, "{") {
+		return p.parseJSON(line)
+	}
+	return parseCommonLog(line)
+}
+
+// ReadAll parses every line of r. Lines that cannot be parsed are counted and
+// skipped, so one malformed line does not abort a replay.
+func (p *Parser) ReadAll(r io.Reader) ([]Entry, int, error) {
+	var entries []Entry
+	skipped := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, err := p.ParseLine(scanner.Text())
+		if errors.Is(err, errEmptyLine) {
+			continue
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, skipped, scanner.Err()
+}
+
+func parseCommonLog(line string) (Entry, error) {
+	host, _, found := strings.Cut(line, " ")
+	if !found {
+		return Entry{}, fmt.Errorf("no remote host in %q", line)
+	}
+
+	start := strings.IndexByte(line, '[')
+	end := strings.IndexByte(line, ']')
+	if start < 0 || end < start {
+		return Entry{}, fmt.Errorf("no timestamp in %q", line)
+	}
+
+	timestamp, err := time.Parse(clfTimeLayout, line[start+1:end])
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Time: timestamp, Key: host}, nil
+}
+
+func (p *Parser) parseJSON(line string) (Entry, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return Entry{}, err
+	}
+
+	timeField, keyField := p.TimeField, p.KeyField
+	if timeField == "" {
+		timeField = "time"
+	}
+	if keyField == "" {
+		keyField = "remote_addr"
+	}
+
+	key, ok := fields[keyField].(string)
+	if !ok || key == "" {
+		return Entry{}, fmt.Errorf("missing %q in %q", keyField, line)
+	}
+
+	var timestamp time.Time
+	switch value := fields[timeField].(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return Entry{}, err
+		}
+		timestamp = parsed
+	case float64:
+		seconds, fraction := int64(value), value-float64(int64(value))
+		timestamp = time.Unix(seconds, int64(fraction*float64(time.Second)))
+	default:
+		return Entry{}, fmt.Errorf("missing %q in %q", timeField, line)
+	}
+	return Entry{Time: timestamp, Key: key}, nil
+}
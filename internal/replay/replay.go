@@ -0,0 +1,165 @@
+package replay
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type Policy struct {
+	Name       string
+	Strategy   string
+	Limit      int
+	WindowSize time.Duration
+}
+
+type KeyCount struct {
+	Key   string
+	Count int
+}
+
+type Result struct {
+	Policy    Policy
+	Allowed   int
+	Rejected  int
+	Throttled []KeyCount
+}
+
+type Report struct {
+	Requests int
+	Results  []Result
+	// Disagreements counts requests some policies allowed and others
+	// rejected.
+	Disagreements    int
+	DisagreementKeys []KeyCount
+}
+
+// Clock is the simulated clock the strategies run on, so their cleanup
+// tickers follow the replayed time as well. It only moves forward, so
+// slightly out of order log lines do not rewind the strategies.
+type Clock struct {
+	*clock.Fake
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{Fake: clock.NewFake(start)}
+}
+
+// Set moves the clock to now and fires the tickers that became due.
+func (c *Clock) Set(now time.Time) {
+	if d := now.Sub(c.Now()); d > 0 {
+		c.Advance(d)
+	}
+}
+
+// Run replays entries in time order against a fresh limiter per policy and
+// reports the top throttled keys of each.
+func Run(entries []Entry, policies []Policy, top int) Report {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	var start time.Time
+	if len(entries) > 0 {
+		start = entries[0].Time
+	}
+	simulated := NewClock(start)
+
+	limiters := make([]*ratelimiter.Ratelimiter, len(policies))
+	throttled := make([]map[string]int, len(policies))
+	report := Report{Requests: len(entries), Results: make([]Result, len(policies))}
+	for i, policy := range policies {
+		limiters[i] = ratelimiter.NewRateLimiter(policy.Limit, policy.WindowSize, simulated, policy.Strategy)
+		defer limiters[i].Stop()
+		throttled[i] = map[string]int{}
+		report.Results[i].Policy = policy
+	}
+
+	disagreements := map[string]int{}
+	for _, entry := range entries {
+		simulated.Set(entry.Time)
+
+		allowedBy := 0
+		for i, limiter := range limiters {
+			if allowed, _ := limiter.IsRequestAllowed(entry.Key); allowed {
+				report.Results[i].Allowed++
+				allowedBy++
+			} else {
+				report.Results[i].Rejected++
+				throttled[i][entry.Key]++
+			}
+		}
+
+		if allowedBy > 0 && allowedBy < len(limiters) {
+			report.Disagreements++
+			disagreements[entry.Key]++
+		}
+	}
+
+	for i := range report.Results {
+		report.Results[i].Throttled = topKeys(throttled[i], top)
+	}
+	report.DisagreementKeys = topKeys(disagreements, top)
+	return report
+}
+
+func topKeys(counts map[string]int, n int) []KeyCount {
+	keys := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		keys = append(keys, KeyCount{Key: key, Count: count})
+	}
+	slices.SortFunc(keys, func(a, b KeyCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// ParsePolicy reads "name=strategy:limit/window", for example
+// "api=token_bucket:100/1m". The name is optional and defaults to the spec.
+func ParsePolicy(spec string) (Policy, error) {
+	name, rest, found := strings.Cut(spec, "=")
+	if !found {
+		name, rest = spec, spec
+	}
+
+	strategy, limits, found := strings.Cut(rest, ":")
+	if !found {
+		return Policy{}, fmt.Errorf("policy %q: expected strategy:limit/window", spec)
+	}
+	definition, err := ratelimiter.LookupStrategy(strategy)
+	if err != nil {
+		return Policy{}, fmt.Errorf("policy %q: %w", spec, err)
+	}
+
+	limitText, windowText, found := strings.Cut(limits, "/")
+	if !found {
+		// Calendar strategies do not need a window.
+		windowText = "0s"
+	}
+	limit, err := strconv.Atoi(limitText)
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("policy %q: invalid limit %q", spec, limitText)
+	}
+	window, err := time.ParseDuration(windowText)
+	if err != nil {
+		return Policy{}, fmt.Errorf("policy %q: %w", spec, err)
+	}
+	if window <= 0 && definition.HasParam("window") {
+		return Policy{}, fmt.Errorf("policy %q: window must be positive", spec)
+	}
+
+	return Policy{Name: name, Strategy: strategy, Limit: limit, WindowSize: window}, nil
+}
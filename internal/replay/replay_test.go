@@ -0,0 +1,141 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func TestParser(t *testing.T) {
+	parser := &Parser{}
+
+	t.Run("common and combined log format", func(t *testing.T) {
+		lines := []string{
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+		}
+		expected := time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC)
+
+		for _, line := range lines {
+			entry, err := parser.ParseLine(line)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if entry.Key != "127.0.0.1" || !entry.Time.Equal(expected) {
+				t.Errorf("unexpected entry %+v", entry)
+			}
+		}
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		entry, err := parser.ParseLine(`{"time": "2024-01-01T12:00:00Z", "remote_addr": "10.0.0.1", "path": "/"}`)
+		if err != nil || entry.Key != "10.0.0.1" || !entry.Time.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected entry %+v %v", entry, err)
+		}
+
+		custom := &Parser{TimeField: "ts", KeyField: "user"}
+		entry, err = custom.ParseLine(`{"ts": 1704110400.5, "user": "ege"}`)
+		if err != nil || entry.Key != "ege" || !entry.Time.Equal(time.Date(2024, 1, 1, 12, 0, 0, 500_000_000, time.UTC)) {
+			t.Errorf("unexpected entry %+v %v", entry, err)
+		}
+	})
+
+	t.Run("skips unparsable lines", func(t *testing.T) {
+		input := strings.Join([]string{
+			`{"time": "2024-01-01T12:00:00Z", "remote_addr": "10.0.0.1"}`,
+			`not a log line`,
+			``,
+			`{"remote_addr": "10.0.0.1"}`,
+		}, "\n")
+
+		entries, skipped, err := parser.ReadAll(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(entries) != 1 || skipped != 2 {
+			t.Errorf("expected 1 entry and 2 skipped got %d and %d", len(entries), skipped)
+		}
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("api=token_bucket:100/1m")
+	if err != nil || policy != (Policy{Name: "api", Strategy: "token_bucket", Limit: 100, WindowSize: time.Minute}) {
+		t.Errorf("unexpected policy %+v %v", policy, err)
+	}
+
+	policy, err = ParsePolicy("calendar_day:1000")
+	if err != nil || policy.Name != "calendar_day:1000" || policy.Limit != 1000 {
+		t.Errorf("unexpected policy %+v %v", policy, err)
+	}
+
+	for _, spec := range []string{"unknown:1/1m", "fixed_window:0/1m", "fixed_window:10", "fixed_window"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var entries []Entry
+	// A burst of 4 at the end of one minute and 4 more right after the
+	// boundary: fixed window allows both bursts, the log allows only 2.
+	for i := range 4 {
+		entries = append(entries, Entry{Time: start.Add(59*time.Second + time.Duration(i)*time.Millisecond), Key: "burst"})
+		entries = append(entries, Entry{Time: start.Add(61*time.Second + time.Duration(i)*time.Millisecond), Key: "burst"})
+	}
+	entries = append(entries, Entry{Time: start, Key: "quiet"})
+
+	report := Run(entries, []Policy{
+		{Name: "fixed", Strategy: "fixed_window", Limit: 4, WindowSize: time.Minute},
+		{Name: "log", Strategy: "sliding_window_log", Limit: 4, WindowSize: time.Minute},
+	}, 10)
+
+	if report.Requests != 9 {
+		t.Errorf("expected 9 requests got %d", report.Requests)
+	}
+	if fixed := report.Results[0]; fixed.Rejected != 0 || fixed.Allowed != 9 {
+		t.Errorf("fixed window should allow both bursts got %+v", fixed)
+	}
+
+	log := report.Results[1]
+	if log.Rejected != 4 {
+		t.Errorf("sliding log should reject the second burst got %d rejections", log.Rejected)
+	}
+	if len(log.Throttled) != 1 || log.Throttled[0] != (KeyCount{Key: "burst", Count: 4}) {
+		t.Errorf("unexpected throttled keys %+v", log.Throttled)
+	}
+
+	if report.Disagreements != 4 || report.DisagreementKeys[0].Key != "burst" {
+		t.Errorf("expected 4 disagreements on burst got %d %+v", report.Disagreements, report.DisagreementKeys)
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var simulated clock.Clock = NewClock(start)
+	replayed := simulated.(*Clock)
+
+	ticker := simulated.NewTicker(time.Minute)
+	defer ticker.Stop()
+	ticked := make(chan time.Time, 1)
+	go func() { ticked <- <-ticker.C() }()
+
+	replayed.Set(start.Add(-time.Second))
+	if !replayed.Now().Equal(start) {
+		t.Errorf("expected the clock not to move back got %v", replayed.Now())
+	}
+
+	replayed.Set(start.Add(time.Minute))
+	select {
+	case now := <-ticked:
+		if !now.Equal(start.Add(time.Minute)) {
+			t.Errorf("expected a tick at the replayed time got %v", now)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected tickers to follow the replayed time")
+	}
+}
@@ -0,0 +1,334 @@
+package strategies
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type CalendarPeriod int
+
+const (
+	Day CalendarPeriod = iota
+	// Week periods start on Monday.
+	Week
+	Month
+)
+
+// CalendarQuotaStrategy counts requests per calendar day, week or month,
+// resetting at local midnight in the identifier's time zone.
+type CalendarQuotaStrategy struct {
+	limit        int
+	period       CalendarPeriod
+	location     *time.Location
+	locationFor  func(identifier string) *time.Location
+	storage      map[string]QuotaData
+	timeProvider TimeProvider
+	mu           sync.RWMutex
+	grants       grantBook
+
+	stopCleanup     chan struct{}
+	cleanupDone     chan struct{}
+	cleanupInterval time.Duration
+
+	keyLimit
+	limitSource
+}
+
+type QuotaData struct {
+	used        int
+	periodStart time.Time
+}
+
+type QuotaUsage struct {
+	Used        int
+	Limit       int
+	Remaining   int
+	PeriodStart time.Time
+	ResetAt     time.Time
+}
+
+func NewCalendarQuotaStrategy(limit int, period CalendarPeriod, location *time.Location, timeProvider TimeProvider) *CalendarQuotaStrategy {
+	if location == nil {
+		location = time.UTC
+	}
+
+	c := &CalendarQuotaStrategy{
+		limit:           limit,
+		period:          period,
+		location:        location,
+		storage:         map[string]QuotaData{},
+		timeProvider:    timeProvider,
+		cleanupInterval: time.Hour,
+		stopCleanup:     make(chan struct{}),
+		cleanupDone:     make(chan struct{}),
+		grants:          grantBook{},
+	}
+
+	go c.startCleanup()
+	return c
+}
+
+func (c *CalendarQuotaStrategy) SetLocation(location *time.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.location = location
+}
+
+// SetLocationFunc resolves the time zone per identifier, for example from the
+// customer's account. Returning nil falls back to the strategy's location.
+func (c *CalendarQuotaStrategy) SetLocationFunc(locationFor func(identifier string) *time.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.locationFor = locationFor
+}
+
+func (c *CalendarQuotaStrategy) IsRequestAllowed(identifier string) (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.admit(identifier, c.evict) {
+		return false, 0
+	}
+
+	now := c.timeProvider.Now()
+	limit := c.limitFor(identifier, now)
+	data := c.current(identifier, now)
+	if data.used >= limit {
+		c.storage[identifier] = data
+		return false, 0
+	}
+
+	data.used++
+	c.storage[identifier] = data
+	return true, limit - data.used
+}
+
+func (c *CalendarQuotaStrategy) Peek(identifier string) (bool, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.admits(identifier) {
+		return false, 0
+	}
+
+	state := c.keyState(identifier, c.timeProvider.Now())
+	return state.Remaining > 0, state.Remaining
+}
+
+// Grant adds n requests to identifier's quota for the rest of the period.
+func (c *CalendarQuotaStrategy) Grant(identifier string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.admit(identifier, c.evict) {
+		return
+	}
+
+	now := c.timeProvider.Now()
+	c.grants.add(identifier, n, now, c.periodEnd(c.periodStart(now, c.locationOf(identifier))))
+}
+
+// Refund gives back n requests counted in the current period.
+func (c *CalendarQuotaStrategy) Refund(identifier string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.storage[identifier]; !exists {
+		return
+	}
+	data := c.current(identifier, c.timeProvider.Now())
+	data.used = max(data.used-n, 0)
+	c.storage[identifier] = data
+}
+
+// limitFor ignores the provider's window size, the period is always the
+// calendar's.
+func (c *CalendarQuotaStrategy) limitFor(identifier string, now time.Time) int {
+	limits := c.resolve(identifier, Limits{Limit: c.limit})
+	return limits.Limit + c.grants.extra(identifier, now)
+}
+
+func (c *CalendarQuotaStrategy) Usage(identifier string) QuotaUsage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.timeProvider.Now()
+	limit := c.limitFor(identifier, now)
+	data := c.current(identifier, now)
+	return QuotaUsage{
+		Used:        data.used,
+		Limit:       limit,
+		Remaining:   max(limit-data.used, 0),
+		PeriodStart: data.periodStart,
+		ResetAt:     c.periodEnd(data.periodStart),
+	}
+}
+
+func (c *CalendarQuotaStrategy) current(identifier string, now time.Time) QuotaData {
+	periodStart := c.periodStart(now, c.locationOf(identifier))
+	data, exists := c.storage[identifier]
+	if !exists || !data.periodStart.Equal(periodStart) {
+		return QuotaData{periodStart: periodStart}
+	}
+	return data
+}
+
+func (c *CalendarQuotaStrategy) locationOf(identifier string) *time.Location {
+	if c.locationFor != nil {
+		if location := c.locationFor(identifier); location != nil {
+			return location
+		}
+	}
+	return c.location
+}
+
+func (c *CalendarQuotaStrategy) periodStart(now time.Time, location *time.Location) time.Time {
+	local := now.In(location)
+	year, month, day := local.Date()
+
+	switch c.period {
+	case Week:
+		daysSinceMonday := (int(local.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, location)
+	case Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, location)
+	}
+}
+
+func (c *CalendarQuotaStrategy) periodEnd(periodStart time.Time) time.Time {
+	switch c.period {
+	case Week:
+		return periodStart.AddDate(0, 0, 7)
+	case Month:
+		return periodStart.AddDate(0, 1, 0)
+	default:
+		return periodStart.AddDate(0, 0, 1)
+	}
+}
+
+func (c *CalendarQuotaStrategy) evict(identifier string) {
+	delete(c.storage, identifier)
+	delete(c.grants, identifier)
+}
+
+type quotaState struct {
+	Used        int       `json:"used"`
+	PeriodStart time.Time `json:"period_start"`
+}
+
+func (c *CalendarQuotaStrategy) SaveState() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	state := make(map[string]quotaState, len(c.storage))
+	for identifier, data := range c.storage {
+		state[identifier] = quotaState{Used: data.used, PeriodStart: data.periodStart}
+	}
+	return json.Marshal(state)
+}
+
+func (c *CalendarQuotaStrategy) LoadState(data []byte) error {
+	var state map[string]quotaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.timeProvider.Now()
+	for identifier, quota := range state {
+		periodStart := c.periodStart(now, c.locationOf(identifier))
+		if quota.PeriodStart.Equal(periodStart) && c.admit(identifier, c.evict) {
+			c.storage[identifier] = QuotaData{used: quota.Used, periodStart: periodStart}
+		}
+	}
+	return nil
+}
+
+func (c *CalendarQuotaStrategy) Stop() {
+	close(c.stopCleanup)
+	<-c.cleanupDone
+}
+
+func (c *CalendarQuotaStrategy) startCleanup() {
+	ticker := clock.From(c.timeProvider).NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.cleanup()
+		case <-c.stopCleanup:
+			close(c.cleanupDone)
+			return
+		}
+	}
+}
+
+func (c *CalendarQuotaStrategy) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.timeProvider.Now()
+	for identifier, data := range c.storage {
+		if !now.Before(c.periodEnd(data.periodStart)) {
+			delete(c.storage, identifier)
+			c.forget(identifier)
+		}
+	}
+	c.grants.prune(now)
+}
+
+func (c *CalendarQuotaStrategy) getStorageSize() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.storage)
+}
+
+func (c *CalendarQuotaStrategy) Inspect() []KeyState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.timeProvider.Now()
+	states := make([]KeyState, 0, len(c.storage))
+	for identifier := range c.storage {
+		states = append(states, c.keyState(identifier, now))
+	}
+	return sortKeyStates(states)
+}
+
+func (c *CalendarQuotaStrategy) InspectKey(identifier string) (KeyState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, exists := c.storage[identifier]
+	return c.keyState(identifier, c.timeProvider.Now()), exists
+}
+
+func (c *CalendarQuotaStrategy) keyState(identifier string, now time.Time) KeyState {
+	limit := c.limitFor(identifier, now)
+	data := c.current(identifier, now)
+	state := KeyState{
+		Identifier: identifier,
+		Count:      data.used,
+		Limit:      limit,
+		Remaining:  max(limit-data.used, 0),
+		ResetAt:    c.periodEnd(data.periodStart),
+	}
+	if state.Remaining == 0 {
+		state.RetryAt = state.ResetAt
+	}
+	return state
+}
+
+func (c *CalendarQuotaStrategy) Reset(identifier string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.storage, identifier)
+	delete(c.grants, identifier)
+	c.forget(identifier)
+}
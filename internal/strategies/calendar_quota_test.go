@@ -0,0 +1,149 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarQuotaStrategy(t *testing.T) {
+	newYork := time.FixedZone("EST", -5*60*60)
+
+	t.Run("monthly quota resets at local midnight on the 1st", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 31, 23, 0, 0, 0, newYork)}
+		strategy := NewCalendarQuotaStrategy(2, Month, newYork, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("ege")
+		strategy.IsRequestAllowed("ege")
+
+		// 04:30 UTC on Feb 1st is still January in New York.
+		mockTimeProvider.currentTime = time.Date(2024, 2, 1, 4, 30, 0, 0, time.UTC)
+		if allowed, _ := strategy.IsRequestAllowed("ege"); allowed {
+			t.Error("quota should not reset before local midnight")
+		}
+
+		mockTimeProvider.currentTime = time.Date(2024, 2, 1, 5, 0, 0, 0, time.UTC)
+		if allowed, remaining := strategy.IsRequestAllowed("ege"); !allowed || remaining != 1 {
+			t.Errorf("quota should reset at local midnight got %t %d", allowed, remaining)
+		}
+	})
+
+	t.Run("weekly quota starts on monday", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC)}
+		strategy := NewCalendarQuotaStrategy(1, Week, time.UTC, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("ege")
+		usage := strategy.Usage("ege")
+
+		if !usage.PeriodStart.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected the week to start on monday got %v", usage.PeriodStart)
+		}
+		if !usage.ResetAt.Equal(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected the week to reset next monday got %v", usage.ResetAt)
+		}
+	})
+
+	t.Run("time zone per identifier", func(t *testing.T) {
+		tokyo := time.FixedZone("JST", 9*60*60)
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)}
+		strategy := NewCalendarQuotaStrategy(1, Day, time.UTC, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetLocationFunc(func(identifier string) *time.Location {
+			if identifier == "tokyo-customer" {
+				return tokyo
+			}
+			return nil
+		})
+
+		strategy.IsRequestAllowed("tokyo-customer")
+		strategy.IsRequestAllowed("utc-customer")
+
+		mockTimeProvider.Advance(2 * time.Hour)
+
+		if allowed, _ := strategy.IsRequestAllowed("tokyo-customer"); !allowed {
+			t.Error("a new day has started in tokyo")
+		}
+		if allowed, _ := strategy.IsRequestAllowed("utc-customer"); allowed {
+			t.Error("the day has not ended in utc")
+		}
+	})
+
+	t.Run("grants are tracked keys", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewCalendarQuotaStrategy(1, Day, time.UTC, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(1, EvictLeastRecentlyUsed)
+
+		strategy.Grant("first", 5)
+		strategy.Grant("second", 5)
+
+		if strategy.Evictions() != 1 {
+			t.Errorf("expected the second grant to evict the first identifier got %d evictions", strategy.Evictions())
+		}
+		strategy.IsRequestAllowed("first")
+		if allowed, _ := strategy.IsRequestAllowed("first"); allowed {
+			t.Error("evicted identifier should have lost its grant")
+		}
+	})
+
+	t.Run("reports usage to date", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)}
+		strategy := NewCalendarQuotaStrategy(10000, Month, time.UTC, mockTimeProvider)
+		defer strategy.Stop()
+
+		for range 37 {
+			strategy.IsRequestAllowed("ege")
+		}
+
+		usage := strategy.Usage("ege")
+		if usage.Used != 37 || usage.Remaining != 9963 || usage.Limit != 10000 {
+			t.Errorf("unexpected usage %+v", usage)
+		}
+		if !usage.ResetAt.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected reset on april 1st got %v", usage.ResetAt)
+		}
+	})
+
+	t.Run("survives a restart within the period", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)}
+		before := NewCalendarQuotaStrategy(5, Month, time.UTC, mockTimeProvider)
+		for range 5 {
+			before.IsRequestAllowed("ege")
+		}
+		data, _ := before.SaveState()
+		before.Stop()
+
+		mockTimeProvider.Advance(24 * time.Hour)
+		after := NewCalendarQuotaStrategy(5, Month, time.UTC, mockTimeProvider)
+		defer after.Stop()
+		after.LoadState(data)
+
+		if allowed, _ := after.IsRequestAllowed("ege"); allowed {
+			t.Error("monthly quota should survive the restart")
+		}
+
+		mockTimeProvider.currentTime = time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+		restarted := NewCalendarQuotaStrategy(5, Month, time.UTC, mockTimeProvider)
+		defer restarted.Stop()
+		restarted.LoadState(data)
+
+		if restarted.getStorageSize() != 0 {
+			t.Error("quota of a finished month should be discarded")
+		}
+	})
+
+	t.Run("cleanup removes finished periods", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)}
+		strategy := NewCalendarQuotaStrategy(5, Day, time.UTC, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("ege")
+		mockTimeProvider.Advance(12 * time.Hour)
+		strategy.cleanup()
+
+		if strategy.getStorageSize() != 0 {
+			t.Errorf("Should be cleaned up got %d", strategy.getStorageSize())
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func TestBackgroundCleanup(t *testing.T) {
+	for name, newStrategy := range testStrategies(1) {
+		t.Run(name, func(t *testing.T) {
+			fakeClock := clock.NewFake(time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC))
+			strategy := newStrategy(fakeClock)
+			fakeClock.BlockUntil(1)
+
+			strategy.IsRequestAllowed("ege")
+			fakeClock.Advance(time.Hour)
+			// Stop waits for the cleanup the tick started.
+			strategy.Stop()
+
+			if len(strategy.Inspect()) != 0 {
+				t.Errorf("background cleanup should have removed the identifier got %+v", strategy.Inspect())
+			}
+		})
+	}
+}
+
+func TestCleanupInterval(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	strategy := NewSlidingWindowCountStrategy(1, 10*time.Second, fakeClock)
+	fakeClock.BlockUntil(1)
+
+	strategy.IsRequestAllowed("ege")
+	fakeClock.Advance(20 * time.Second)
+	strategy.Stop()
+
+	if len(strategy.Inspect()) != 0 {
+		t.Errorf("cleanup should follow the window size got %+v", strategy.Inspect())
+	}
+}
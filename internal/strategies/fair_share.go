@@ -0,0 +1,338 @@
+package strategies
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type tenantUsage struct {
+	admitted int
+	attempts int
+	// previous is the attempts of the last window, the tenant's expected
+	// demand for this one.
+	previous int
+}
+
+func (t *tenantUsage) demand() int {
+	return max(t.attempts, t.previous)
+}
+
+// FairShareStrategy splits one global limit per window between the tenants
+// active in this or the previous window by weighted max-min fairness:
+// tenants that need less than their weighted share get what they need, and
+// the rest is split between the others by weight. A tenant's demand is the
+// larger of its attempts in this and the previous window, so shares follow
+// tenants as they become active or idle and unused capacity goes to the
+// tenants that want it. A LimitProvider caps a tenant's share at its Limit,
+// the window is the same for every tenant.
+type FairShareStrategy struct {
+	limit        int
+	windowSize   time.Duration
+	timeProvider TimeProvider
+
+	mu      sync.Mutex
+	window  time.Time
+	total   int
+	tenants map[string]*tenantUsage
+	weights map[string]float64
+	grants  grantBook
+	// cached holds the shares until demand or weights change, nil if they
+	// have to be computed again.
+	cached map[string]float64
+
+	stopCleanup chan struct{}
+	cleanupDone chan struct{}
+
+	keyLimit
+	limitSource
+}
+
+func NewFairShareStrategy(limit int, windowSize time.Duration, timeProvider TimeProvider) *FairShareStrategy {
+	f := &FairShareStrategy{
+		limit:        limit,
+		windowSize:   windowSize,
+		timeProvider: timeProvider,
+		tenants:      map[string]*tenantUsage{},
+		weights:      map[string]float64{},
+		grants:       grantBook{},
+		stopCleanup:  make(chan struct{}),
+		cleanupDone:  make(chan struct{}),
+	}
+
+	go f.startCleanup()
+	return f
+}
+
+// SetWeight gives identifier weight times the share of a tenant with the
+// default weight of 1. Weights that are not positive restore the default.
+func (f *FairShareStrategy) SetWeight(identifier string, weight float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cached = nil
+	if weight <= 0 {
+		delete(f.weights, identifier)
+		return
+	}
+	f.weights[identifier] = weight
+}
+
+func (f *FairShareStrategy) IsRequestAllowed(identifier string) (bool, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.admit(identifier, f.evict) {
+		return false, 0
+	}
+
+	now := f.timeProvider.Now()
+	f.roll(now)
+
+	tenant := f.attempt(identifier)
+	remaining := f.remaining(identifier, now)
+	if remaining <= 0 {
+		return false, 0
+	}
+	tenant.admitted++
+	f.total++
+	return true, remaining - 1
+}
+
+func (f *FairShareStrategy) Peek(identifier string) (bool, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.admits(identifier) {
+		return false, 0
+	}
+
+	now := f.timeProvider.Now()
+	f.roll(now)
+
+	// Peek as if the request was made, so an idle tenant sees the share it
+	// would get, and restore the tenant and the shares afterwards.
+	_, exists := f.tenants[identifier]
+	cached := f.cached
+	tenant := f.attempt(identifier)
+	remaining := max(f.remaining(identifier, now), 0)
+
+	tenant.attempts--
+	if !exists {
+		delete(f.tenants, identifier)
+	}
+	f.cached = cached
+	return remaining > 0, remaining
+}
+
+// attempt counts a request of identifier. The cached shares stay valid
+// unless the request raises a demand they did not cap.
+func (f *FairShareStrategy) attempt(identifier string) *tenantUsage {
+	tenant, exists := f.tenants[identifier]
+	if !exists {
+		tenant = &tenantUsage{}
+		f.tenants[identifier] = tenant
+	}
+
+	demand := tenant.demand()
+	tenant.attempts++
+	if share, cached := f.cached[identifier]; tenant.demand() > demand && (!cached || share >= float64(demand)-1e-9) {
+		f.cached = nil
+	}
+	return tenant
+}
+
+// remaining is what identifier may still use of its share and of the
+// global limit.
+func (f *FairShareStrategy) remaining(identifier string, now time.Time) int {
+	extra := f.grants.extra(identifier, now)
+	share := shareLimit(f.shares()[identifier])
+	return min(share+extra-f.tenants[identifier].admitted, f.limit+extra-f.total)
+}
+
+// Shares returns the current share of every active tenant.
+func (f *FairShareStrategy) Shares() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.timeProvider.Now()
+	f.roll(now)
+
+	shares := map[string]int{}
+	for identifier, share := range f.shares() {
+		shares[identifier] = shareLimit(share)
+	}
+	return shares
+}
+
+func (f *FairShareStrategy) shares() map[string]float64 {
+	if f.cached == nil {
+		f.cached = f.computeShares()
+	}
+	return f.cached
+}
+
+// computeShares fills the limit like water: tenants are visited by demand
+// per weight, and each gets the smaller of its demand and its weighted part
+// of what the tenants before it left.
+func (f *FairShareStrategy) computeShares() map[string]float64 {
+	type demand struct {
+		identifier string
+		demand     float64
+		weight     float64
+	}
+
+	var demands []demand
+	totalWeight := 0.0
+	for identifier, tenant := range f.tenants {
+		if tenant.demand() == 0 {
+			continue
+		}
+		weight := f.weight(identifier)
+		need := min(tenant.demand(), f.limitsOf(identifier).Limit)
+		demands = append(demands, demand{identifier, float64(need), weight})
+		totalWeight += weight
+	}
+	slices.SortFunc(demands, func(a, b demand) int {
+		if a.demand/a.weight < b.demand/b.weight {
+			return -1
+		}
+		if a.demand/a.weight > b.demand/b.weight {
+			return 1
+		}
+		return 0
+	})
+
+	shares := make(map[string]float64, len(demands))
+	left := float64(f.limit)
+	for _, d := range demands {
+		share := min(d.demand, left*d.weight/totalWeight)
+		shares[d.identifier] = share
+		left -= share
+		totalWeight -= d.weight
+	}
+	return shares
+}
+
+// shareLimit rounds fractional shares up so no capacity is lost to rounding.
+// The global limit still caps the total.
+func shareLimit(share float64) int {
+	return int(math.Ceil(share - 1e-9))
+}
+
+func (f *FairShareStrategy) limitsOf(identifier string) Limits {
+	return f.resolve(identifier, Limits{Limit: f.limit, WindowSize: f.windowSize})
+}
+
+func (f *FairShareStrategy) weight(identifier string) float64 {
+	if weight, exists := f.weights[identifier]; exists {
+		return weight
+	}
+	return 1
+}
+
+// roll starts a new window, keeping the attempts of the one that just ended
+// as every tenant's expected demand.
+func (f *FairShareStrategy) roll(now time.Time) {
+	window := now.Truncate(f.windowSize)
+	if window.Equal(f.window) {
+		return
+	}
+
+	consecutive := window.Equal(f.window.Add(f.windowSize))
+	for _, tenant := range f.tenants {
+		tenant.previous = 0
+		if consecutive {
+			tenant.previous = tenant.attempts
+		}
+		tenant.attempts = 0
+		tenant.admitted = 0
+	}
+	f.window = window
+	f.total = 0
+	f.cached = nil
+}
+
+func (f *FairShareStrategy) Reset(identifier string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if tenant, exists := f.tenants[identifier]; exists {
+		f.total -= tenant.admitted
+		delete(f.tenants, identifier)
+		f.cached = nil
+	}
+	delete(f.grants, identifier)
+	f.forget(identifier)
+}
+
+// evict forgets identifier's demand. What it was admitted still counts
+// towards the global limit until the window ends.
+func (f *FairShareStrategy) evict(identifier string) {
+	delete(f.tenants, identifier)
+	delete(f.grants, identifier)
+	f.cached = nil
+}
+
+// Grant lets identifier use n requests beyond its share and the global limit
+// until the current window ends.
+func (f *FairShareStrategy) Grant(identifier string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.admit(identifier, f.evict) {
+		return
+	}
+
+	now := f.timeProvider.Now()
+	f.grants.add(identifier, n, now, now.Truncate(f.windowSize).Add(f.windowSize))
+}
+
+// Refund gives back n requests admitted in the current window.
+func (f *FairShareStrategy) Refund(identifier string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.roll(f.timeProvider.Now())
+	if tenant, exists := f.tenants[identifier]; exists {
+		refunded := min(n, tenant.admitted)
+		tenant.admitted -= refunded
+		f.total -= refunded
+	}
+}
+
+func (f *FairShareStrategy) Stop() {
+	close(f.stopCleanup)
+	<-f.cleanupDone
+}
+
+// cleanup forgets tenants without attempts in this or the previous window.
+func (f *FairShareStrategy) cleanup() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.timeProvider.Now()
+	f.roll(now)
+	for identifier, tenant := range f.tenants {
+		if tenant.demand() == 0 {
+			delete(f.tenants, identifier)
+			f.forget(identifier)
+		}
+	}
+	f.grants.prune(now)
+}
+
+func (f *FairShareStrategy) startCleanup() {
+	ticker := clock.From(f.timeProvider).NewTicker(f.windowSize)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			f.cleanup()
+		case <-f.stopCleanup:
+			close(f.cleanupDone)
+			return
+		}
+	}
+}
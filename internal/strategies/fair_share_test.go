@@ -0,0 +1,169 @@
+package strategies
+
+import (
+	"maps"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func sendRequests(f *FairShareStrategy, identifier string, n int) int {
+	allowed := 0
+	for range n {
+		if ok, _ := f.IsRequestAllowed(identifier); ok {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestFairShareStrategy(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("a noisy tenant does not starve the others", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+
+		sendRequests(f, "noisy", 100)
+		sendRequests(f, "quiet", 5)
+
+		// The next window splits the limit by the demand of the last one.
+		tp.Advance(time.Minute)
+		if allowed := sendRequests(f, "noisy", 100); allowed != 5 {
+			t.Errorf("expected the noisy tenant to be held to 5 got %d", allowed)
+		}
+		if allowed := sendRequests(f, "quiet", 5); allowed != 5 {
+			t.Errorf("expected the quiet tenant to get its 5 got %d", allowed)
+		}
+	})
+
+	t.Run("tenants that need less leave the rest to the others", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+
+		sendRequests(f, "small", 2)
+		sendRequests(f, "a", 20)
+		sendRequests(f, "b", 20)
+		tp.Advance(time.Minute)
+
+		expected := map[string]int{"small": 2, "a": 4, "b": 4}
+		if shares := f.Shares(); !maps.Equal(shares, expected) {
+			t.Errorf("expected max-min shares %v got %v", expected, shares)
+		}
+	})
+
+	t.Run("weights", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(12, time.Minute, tp)
+		defer f.Stop()
+		f.SetWeight("gold", 3)
+
+		sendRequests(f, "gold", 20)
+		sendRequests(f, "bronze", 20)
+		tp.Advance(time.Minute)
+
+		if allowed := sendRequests(f, "bronze", 20); allowed != 3 {
+			t.Errorf("expected bronze to get a quarter of 12 got %d", allowed)
+		}
+		if allowed := sendRequests(f, "gold", 20); allowed != 9 {
+			t.Errorf("expected gold to get three quarters of 12 got %d", allowed)
+		}
+	})
+
+	t.Run("idle tenants give their share back", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+
+		sendRequests(f, "a", 20)
+		sendRequests(f, "b", 20)
+		tp.Advance(time.Minute)
+		sendRequests(f, "a", 20)
+
+		// b sent nothing in the last window and is no longer active.
+		tp.Advance(time.Minute)
+		if allowed := sendRequests(f, "a", 20); allowed != 10 {
+			t.Errorf("expected a to get the whole limit once b is idle got %d", allowed)
+		}
+		if _, active := f.Shares()["b"]; active {
+			t.Error("expected no share for an idle tenant")
+		}
+	})
+
+	t.Run("peek does not consume", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(2, time.Minute, tp)
+		defer f.Stop()
+
+		if ok, remaining := f.Peek("ege"); !ok || remaining != 1 {
+			t.Errorf("expected a new tenant to see a share of its single request got %v, %d", ok, remaining)
+		}
+		if len(f.Shares()) != 0 {
+			t.Errorf("expected peek not to make the tenant active got %v", f.Shares())
+		}
+		if allowed := sendRequests(f, "ege", 3); allowed != 2 {
+			t.Errorf("expected the global limit of 2 got %d", allowed)
+		}
+	})
+
+	t.Run("shares are only recomputed when demand changes", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+
+		sendRequests(f, "a", 20)
+		sendRequests(f, "b", 20)
+		tp.Advance(time.Minute)
+		sendRequests(f, "a", 1)
+
+		// a already wants more than its share, asking for more changes nothing.
+		cached := f.cached
+		sendRequests(f, "a", 10)
+		if reflect.ValueOf(f.cached).Pointer() != reflect.ValueOf(cached).Pointer() {
+			t.Error("expected the shares to stay cached")
+		}
+
+		sendRequests(f, "c", 1)
+		expected := map[string]int{"a": 5, "b": 5, "c": 1}
+		if shares := f.Shares(); !maps.Equal(shares, expected) {
+			t.Errorf("expected a new tenant to change the shares to %v got %v", expected, shares)
+		}
+	})
+
+	t.Run("limit providers cap shares", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+		f.SetLimitProvider(LimitProviderFunc(func(identifier string) Limits {
+			if identifier == "free" {
+				return Limits{Limit: 2}
+			}
+			return Limits{}
+		}))
+
+		if allowed := sendRequests(f, "free", 20); allowed != 2 {
+			t.Errorf("expected the free tenant to be held to its limit of 2 got %d", allowed)
+		}
+		if allowed := sendRequests(f, "paid", 20); allowed != 8 {
+			t.Errorf("expected the paid tenant to get the rest got %d", allowed)
+		}
+	})
+
+	t.Run("key limits", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		f := NewFairShareStrategy(10, time.Minute, tp)
+		defer f.Stop()
+		f.SetKeyLimit(2, DenyNewKeys)
+
+		sendRequests(f, "a", 1)
+		sendRequests(f, "b", 1)
+		if allowed, _ := f.IsRequestAllowed("c"); allowed {
+			t.Error("expected a third tenant to be denied")
+		}
+		if _, active := f.Shares()["c"]; active {
+			t.Error("expected the denied tenant not to get a share")
+		}
+	})
+}
@@ -1,8 +1,11 @@
 package strategies
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
 )
 
 type FixedWindowStrategy struct {
@@ -15,6 +18,10 @@ type FixedWindowStrategy struct {
 	cleanupDone     chan struct{}
 	cleanupInterval time.Duration
 	timeProvider    TimeProvider
+	grants          grantBook
+
+	keyLimit
+	limitSource
 }
 
 type WindowData struct {
@@ -25,22 +32,74 @@ type WindowData struct {
 func (f *FixedWindowStrategy) IsRequestAllowed(identifier string) (bool, int) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	if !f.admit(identifier, f.evict) {
+		return false, 0
+	}
+
+	now := f.timeProvider.Now()
+	limits := f.limitsOf(identifier)
+	limit := f.limitFor(identifier, limits, now)
 	data, exists := f.storage[identifier]
-	currentWindow := f.timeProvider.Now().Truncate(f.windowSize)
+	currentWindow := now.Truncate(limits.WindowSize)
 	if !exists || currentWindow != data.timestamp {
 		f.storage[identifier] = WindowData{count: 1, timestamp: currentWindow}
-		return true, f.limit - 1
+		return true, limit - 1
 	}
 
-	if data.count < f.limit {
+	if data.count < limit {
 		data.count++
 		f.storage[identifier] = data
-		return true, f.limit - data.count
+		return true, limit - data.count
 	}
 
 	return false, 0
 }
 
+func (f *FixedWindowStrategy) Peek(identifier string) (bool, int) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if !f.admits(identifier) {
+		return false, 0
+	}
+
+	state := f.keyState(identifier, f.timeProvider.Now())
+	return state.Remaining > 0, state.Remaining
+}
+
+// Grant adds n requests to identifier's limit until the current window ends.
+func (f *FixedWindowStrategy) Grant(identifier string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.admit(identifier, f.evict) {
+		return
+	}
+
+	now := f.timeProvider.Now()
+	windowSize := f.limitsOf(identifier).WindowSize
+	f.grants.add(identifier, n, now, now.Truncate(windowSize).Add(windowSize))
+}
+
+// Refund gives back n requests counted in the current window.
+func (f *FixedWindowStrategy) Refund(identifier string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, exists := f.storage[identifier]
+	if !exists || data.timestamp != f.timeProvider.Now().Truncate(f.limitsOf(identifier).WindowSize) {
+		return
+	}
+	data.count = max(data.count-n, 0)
+	f.storage[identifier] = data
+}
+
+func (f *FixedWindowStrategy) limitsOf(identifier string) Limits {
+	return f.resolve(identifier, Limits{Limit: f.limit, WindowSize: f.windowSize})
+}
+
+func (f *FixedWindowStrategy) limitFor(identifier string, limits Limits, now time.Time) int {
+	return limits.Limit + f.grants.extra(identifier, now)
+}
+
 func (f *FixedWindowStrategy) Stop() {
 	close(f.stopCleanup)
 	<-f.cleanupDone
@@ -55,6 +114,7 @@ func NewFixedWindowStrategy(limit int, windowSize time.Duration, TimeProvider Ti
 		stopCleanup:     make(chan struct{}),
 		cleanupDone:     make(chan struct{}),
 		timeProvider:    TimeProvider,
+		grants:          grantBook{},
 	}
 
 	go f.startCleanup()
@@ -66,20 +126,27 @@ func (f *FixedWindowStrategy) cleanup() {
 	defer f.mu.Unlock()
 
 	for identifier, data := range f.storage {
-		currentWindow := f.timeProvider.Now().Truncate(f.windowSize)
+		currentWindow := f.timeProvider.Now().Truncate(f.limitsOf(identifier).WindowSize)
 		if currentWindow != data.timestamp {
 			delete(f.storage, identifier)
+			f.forget(identifier)
 		}
 	}
+	f.grants.prune(f.timeProvider.Now())
+}
+
+func (f *FixedWindowStrategy) evict(identifier string) {
+	delete(f.storage, identifier)
+	delete(f.grants, identifier)
 }
 
 func (f *FixedWindowStrategy) startCleanup() {
-	ticker := time.NewTicker(f.cleanupInterval)
+	ticker := clock.From(f.timeProvider).NewTicker(f.cleanupInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			f.cleanup()
 		case <-f.stopCleanup:
 			close(f.cleanupDone)
@@ -93,3 +160,76 @@ func (f *FixedWindowStrategy) getStorageSize() int {
 	defer f.mu.RUnlock()
 	return len(f.storage)
 }
+
+func (f *FixedWindowStrategy) SaveState() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	state := make(map[string]windowState, len(f.storage))
+	for identifier, data := range f.storage {
+		state[identifier] = newWindowState(data)
+	}
+	return json.Marshal(state)
+}
+
+func (f *FixedWindowStrategy) LoadState(data []byte) error {
+	var state map[string]windowState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.timeProvider.Now()
+	for identifier, window := range state {
+		currentWindow := now.Truncate(f.limitsOf(identifier).WindowSize)
+		if window.Timestamp.Equal(currentWindow) && f.admit(identifier, f.evict) {
+			f.storage[identifier] = window.windowData()
+		}
+	}
+	return nil
+}
+
+func (f *FixedWindowStrategy) Inspect() []KeyState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	now := f.timeProvider.Now()
+	states := make([]KeyState, 0, len(f.storage))
+	for identifier := range f.storage {
+		states = append(states, f.keyState(identifier, now))
+	}
+	return sortKeyStates(states)
+}
+
+func (f *FixedWindowStrategy) InspectKey(identifier string) (KeyState, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	_, exists := f.storage[identifier]
+	return f.keyState(identifier, f.timeProvider.Now()), exists
+}
+
+func (f *FixedWindowStrategy) keyState(identifier string, now time.Time) KeyState {
+	limits := f.limitsOf(identifier)
+	currentWindow := now.Truncate(limits.WindowSize)
+	state := KeyState{Identifier: identifier, Limit: f.limitFor(identifier, limits, now), ResetAt: currentWindow.Add(limits.WindowSize)}
+	if data, exists := f.storage[identifier]; exists && data.timestamp == currentWindow {
+		state.Count = data.count
+	}
+	state.Remaining = max(state.Limit-state.Count, 0)
+	if state.Remaining == 0 {
+		state.RetryAt = state.ResetAt
+	}
+	return state
+}
+
+func (f *FixedWindowStrategy) Reset(identifier string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.storage, identifier)
+	delete(f.grants, identifier)
+	f.forget(identifier)
+}
@@ -0,0 +1,63 @@
+package strategies
+
+import "time"
+
+type grant struct {
+	n         int
+	expiresAt time.Time
+	// used counts the requests paid by the grant, for strategies that spend
+	// it like tokens and have to refund them to it.
+	used int
+}
+
+// grantBook holds temporary extra capacity per identifier. It is guarded by
+// the owning strategy's mutex.
+type grantBook map[string]grant
+
+func (g grantBook) extra(identifier string, now time.Time) int {
+	granted, exists := g[identifier]
+	if !exists || !now.Before(granted.expiresAt) {
+		return 0
+	}
+	return granted.n
+}
+
+// add stacks n on top of a grant that is still running and extends it to
+// expiresAt.
+func (g grantBook) add(identifier string, n int, now, expiresAt time.Time) {
+	granted, exists := g[identifier]
+	if !exists || !now.Before(granted.expiresAt) {
+		granted = grant{}
+	}
+	g[identifier] = grant{n: granted.n + n, expiresAt: expiresAt, used: granted.used}
+}
+
+// spend pays one request from a running grant.
+func (g grantBook) spend(identifier string) {
+	granted := g[identifier]
+	granted.n--
+	granted.used++
+	g[identifier] = granted
+}
+
+// refund gives up to n requests paid by a running grant back to it and
+// returns how many it took.
+func (g grantBook) refund(identifier string, n int, now time.Time) int {
+	granted, exists := g[identifier]
+	if !exists || !now.Before(granted.expiresAt) {
+		return 0
+	}
+	refunded := min(n, granted.used)
+	granted.n += refunded
+	granted.used -= refunded
+	g[identifier] = granted
+	return refunded
+}
+
+func (g grantBook) prune(now time.Time) {
+	for identifier, granted := range g {
+		if !now.Before(granted.expiresAt) {
+			delete(g, identifier)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package strategies
+
+import (
+	"sort"
+	"time"
+)
+
+// KeyState describes what a strategy currently tracks for one identifier.
+// Reading it never consumes quota.
+type KeyState struct {
+	Identifier string
+	Count      int
+	Limit      int
+	Remaining  int
+	ResetAt    time.Time
+	// RetryAt is when a request is allowed again, zero while Remaining is
+	// above zero.
+	RetryAt time.Time
+}
+
+func sortKeyStates(states []KeyState) []KeyState {
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Identifier < states[j].Identifier
+	})
+	return states
+}
@@ -0,0 +1,82 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	for name, newStrategy := range testStrategies(3) {
+		t.Run(name+" inspection does not consume quota", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			strategy.IsRequestAllowed("ege")
+			strategy.IsRequestAllowed("ege")
+
+			for range 5 {
+				state, tracked := strategy.InspectKey("ege")
+				if !tracked || state.Count != 2 || state.Remaining != 1 || state.Limit != 3 {
+					t.Errorf("unexpected state %+v tracked %t", state, tracked)
+				}
+				if state.ResetAt.IsZero() {
+					t.Error("expected a reset time")
+				}
+			}
+
+			if allowed, remaining := strategy.IsRequestAllowed("ege"); !allowed || remaining != 0 {
+				t.Errorf("inspection should not have consumed quota got %t %d", allowed, remaining)
+			}
+		})
+
+		t.Run(name+" reports when the next request is allowed", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			if state, _ := strategy.InspectKey("ege"); !state.RetryAt.IsZero() {
+				t.Errorf("expected no retry time while requests are left got %v", state.RetryAt)
+			}
+			for range 3 {
+				strategy.IsRequestAllowed("ege")
+			}
+
+			state, _ := strategy.InspectKey("ege")
+			if !state.RetryAt.After(mockTimeProvider.Now()) {
+				t.Fatalf("expected a retry time after now got %v", state.RetryAt)
+			}
+			mockTimeProvider.currentTime = state.RetryAt.Add(-time.Second)
+			if allowed, _ := strategy.IsRequestAllowed("ege"); allowed {
+				t.Error("expected a rejection before the retry time")
+			}
+			mockTimeProvider.currentTime = state.RetryAt.Add(time.Second)
+			if allowed, _ := strategy.IsRequestAllowed("ege"); !allowed {
+				t.Error("expected the request to be allowed after the retry time")
+			}
+		})
+
+		t.Run(name+" lists tracked identifiers and resets them", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			strategy.IsRequestAllowed("b")
+			strategy.IsRequestAllowed("a")
+
+			states := strategy.Inspect()
+			if len(states) != 2 || states[0].Identifier != "a" || states[1].Identifier != "b" {
+				t.Errorf("expected a and b to be listed got %+v", states)
+			}
+
+			strategy.Reset("a")
+
+			if _, tracked := strategy.InspectKey("a"); tracked {
+				t.Error("reset identifier should no longer be tracked")
+			}
+			if len(strategy.Inspect()) != 1 {
+				t.Errorf("expected 1 tracked identifier got %d", len(strategy.Inspect()))
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package strategies
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+type EvictionPolicy int
+
+const (
+	// EvictLeastRecentlyUsed drops the least recently seen identifier to make
+	// room for a new one.
+	EvictLeastRecentlyUsed EvictionPolicy = iota
+	// DenyNewKeys rejects identifiers that are not tracked yet while full.
+	DenyNewKeys
+)
+
+// keyLimit bounds the number of identifiers a strategy tracks. It is embedded
+// in every strategy and is disabled until SetKeyLimit is called.
+type keyLimit struct {
+	keysMu    sync.Mutex
+	maxKeys   int
+	policy    EvictionPolicy
+	order     *list.List
+	elements  map[string]*list.Element
+	evictions atomic.Int64
+}
+
+// SetKeyLimit caps the number of tracked identifiers. A maxKeys of zero
+// removes the cap. Lowering the cap takes effect as new identifiers arrive.
+func (k *keyLimit) SetKeyLimit(maxKeys int, policy EvictionPolicy) {
+	k.keysMu.Lock()
+	defer k.keysMu.Unlock()
+
+	k.maxKeys = maxKeys
+	k.policy = policy
+	if k.order == nil {
+		k.order = list.New()
+		k.elements = map[string]*list.Element{}
+	}
+}
+
+func (k *keyLimit) Evictions() int64 {
+	return k.evictions.Load()
+}
+
+// admit marks identifier as used. It reports false if identifier is new and
+// must be denied, and calls evict for every identifier dropped to make room.
+func (k *keyLimit) admit(identifier string, evict func(identifier string)) bool {
+	k.keysMu.Lock()
+	defer k.keysMu.Unlock()
+
+	if k.order == nil {
+		return true
+	}
+
+	if element, exists := k.elements[identifier]; exists {
+		k.order.MoveToFront(element)
+		return true
+	}
+
+	if k.maxKeys > 0 && k.order.Len() >= k.maxKeys {
+		if k.policy == DenyNewKeys {
+			return false
+		}
+
+		for k.order.Len() >= k.maxKeys {
+			oldest := k.order.Back()
+			evicted := k.order.Remove(oldest).(string)
+			delete(k.elements, evicted)
+			evict(evicted)
+			k.evictions.Add(1)
+		}
+	}
+
+	k.elements[identifier] = k.order.PushFront(identifier)
+	return true
+}
+
+// admits reports whether admit would let identifier in, without marking it
+// as used.
+func (k *keyLimit) admits(identifier string) bool {
+	k.keysMu.Lock()
+	defer k.keysMu.Unlock()
+
+	if k.order == nil || k.maxKeys <= 0 || k.policy != DenyNewKeys {
+		return true
+	}
+	_, exists := k.elements[identifier]
+	return exists || k.order.Len() < k.maxKeys
+}
+
+func (k *keyLimit) forget(identifier string) {
+	k.keysMu.Lock()
+	defer k.keysMu.Unlock()
+
+	if element, exists := k.elements[identifier]; exists {
+		k.order.Remove(element)
+		delete(k.elements, identifier)
+	}
+}
@@ -0,0 +1,128 @@
+package strategies
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKeyLimit(t *testing.T) {
+	t.Run("evicts the least recently used identifier", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewFixedWindowStrategy(1, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(2, EvictLeastRecentlyUsed)
+
+		strategy.IsRequestAllowed("first")
+		strategy.IsRequestAllowed("second")
+		strategy.IsRequestAllowed("first")
+		strategy.IsRequestAllowed("third")
+
+		if strategy.getStorageSize() != 2 {
+			t.Errorf("expected 2 tracked identifiers got %d", strategy.getStorageSize())
+		}
+		if strategy.Evictions() != 1 {
+			t.Errorf("expected 1 eviction got %d", strategy.Evictions())
+		}
+		if allowed, _ := strategy.IsRequestAllowed("first"); allowed {
+			t.Error("recently used identifier should not have been evicted")
+		}
+		if allowed, _ := strategy.IsRequestAllowed("second"); !allowed {
+			t.Error("evicted identifier should start over")
+		}
+	})
+
+	t.Run("denies new identifiers when full", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewSlidingWindowLogStrategy(10, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(2, DenyNewKeys)
+
+		strategy.IsRequestAllowed("first")
+		strategy.IsRequestAllowed("second")
+
+		if allowed, _ := strategy.IsRequestAllowed("third"); allowed {
+			t.Error("new identifier should be denied when full")
+		}
+		if allowed, _ := strategy.IsRequestAllowed("first"); !allowed {
+			t.Error("tracked identifier should still be allowed")
+		}
+		if strategy.Evictions() != 0 {
+			t.Errorf("expected no evictions got %d", strategy.Evictions())
+		}
+	})
+
+	t.Run("peek denies new identifiers when full without tracking them", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewFixedWindowStrategy(10, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(2, DenyNewKeys)
+
+		strategy.IsRequestAllowed("first")
+		if allowed, remaining := strategy.Peek("second"); !allowed || remaining != 10 {
+			t.Errorf("expected room for a new identifier got %t %d", allowed, remaining)
+		}
+		strategy.IsRequestAllowed("second")
+
+		if allowed, remaining := strategy.Peek("third"); allowed || remaining != 0 {
+			t.Errorf("new identifier should be denied when full got %t %d", allowed, remaining)
+		}
+		if allowed, _ := strategy.Peek("first"); !allowed {
+			t.Error("tracked identifier should still be allowed")
+		}
+		if strategy.getStorageSize() != 2 {
+			t.Errorf("expected peeking not to track identifiers got %d", strategy.getStorageSize())
+		}
+	})
+
+	t.Run("cleanup frees room for new identifiers", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewSlidingWindowCountStrategy(10, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(2, DenyNewKeys)
+
+		strategy.IsRequestAllowed("first")
+		strategy.IsRequestAllowed("second")
+		mockTimeProvider.Advance(2 * time.Minute)
+		strategy.cleanup()
+
+		if allowed, _ := strategy.IsRequestAllowed("third"); !allowed {
+			t.Error("new identifier should be allowed after cleanup")
+		}
+	})
+
+	t.Run("storage stays bounded under rotating identifiers", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetKeyLimit(100, EvictLeastRecentlyUsed)
+
+		for i := range 1000 {
+			strategy.IsRequestAllowed(fmt.Sprintf("attacker-%d", i))
+		}
+
+		if strategy.getStorageSize() != 100 {
+			t.Errorf("expected 100 tracked identifiers got %d", strategy.getStorageSize())
+		}
+		if strategy.Evictions() != 900 {
+			t.Errorf("expected 900 evictions got %d", strategy.Evictions())
+		}
+	})
+
+	for name, newStrategy := range testStrategies(1) {
+		t.Run(name+" eviction drops grants", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+			strategy.SetKeyLimit(1, EvictLeastRecentlyUsed)
+
+			strategy.Grant("first", 5)
+			strategy.IsRequestAllowed("second")
+
+			strategy.IsRequestAllowed("first")
+			if allowed, _ := strategy.IsRequestAllowed("first"); allowed {
+				t.Error("evicted identifier should have lost its grant")
+			}
+		})
+	}
+}
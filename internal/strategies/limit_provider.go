@@ -0,0 +1,124 @@
+package strategies
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Limits struct {
+	Limit      int
+	WindowSize time.Duration
+}
+
+// LimitProvider resolves the limits of a single identifier, for example from
+// the customer's plan. Zero fields fall back to the limits the strategy was
+// constructed with. Strategies call it while holding their lock, so slow
+// sources should be wrapped in a CachedLimitProvider.
+type LimitProvider interface {
+	LimitsFor(identifier string) Limits
+}
+
+type LimitProviderFunc func(identifier string) Limits
+
+func (f LimitProviderFunc) LimitsFor(identifier string) Limits {
+	return f(identifier)
+}
+
+type providerHolder struct {
+	provider LimitProvider
+}
+
+// limitSource is embedded in every strategy to consult an optional
+// LimitProvider.
+type limitSource struct {
+	provider atomic.Value
+}
+
+func (l *limitSource) SetLimitProvider(provider LimitProvider) {
+	l.provider.Store(providerHolder{provider: provider})
+}
+
+func (l *limitSource) resolve(identifier string, defaults Limits) Limits {
+	holder, ok := l.provider.Load().(providerHolder)
+	if !ok || holder.provider == nil {
+		return defaults
+	}
+
+	limits := holder.provider.LimitsFor(identifier)
+	if limits.Limit <= 0 {
+		limits.Limit = defaults.Limit
+	}
+	if limits.WindowSize <= 0 {
+		limits.WindowSize = defaults.WindowSize
+	}
+	return limits
+}
+
+type cachedLimits struct {
+	limits    Limits
+	fetchedAt time.Time
+}
+
+// CachedLimitProvider remembers what source returned for refreshInterval, so
+// plan changes take effect within that interval.
+type CachedLimitProvider struct {
+	source          LimitProvider
+	refreshInterval time.Duration
+	timeProvider    TimeProvider
+
+	mu        sync.Mutex
+	cache     map[string]cachedLimits
+	lastPrune time.Time
+}
+
+func NewCachedLimitProvider(source LimitProvider, refreshInterval time.Duration, timeProvider TimeProvider) *CachedLimitProvider {
+	return &CachedLimitProvider{
+		source:          source,
+		refreshInterval: refreshInterval,
+		timeProvider:    timeProvider,
+		cache:           map[string]cachedLimits{},
+		lastPrune:       timeProvider.Now(),
+	}
+}
+
+func (c *CachedLimitProvider) LimitsFor(identifier string) Limits {
+	now := c.timeProvider.Now()
+
+	c.mu.Lock()
+	cached, exists := c.cache[identifier]
+	c.prune(now)
+	c.mu.Unlock()
+
+	if exists && now.Sub(cached.fetchedAt) < c.refreshInterval {
+		return cached.limits
+	}
+
+	limits := c.source.LimitsFor(identifier)
+
+	c.mu.Lock()
+	c.cache[identifier] = cachedLimits{limits: limits, fetchedAt: now}
+	c.mu.Unlock()
+	return limits
+}
+
+// Invalidate drops the cached limits of identifier so the next lookup asks
+// the source again.
+func (c *CachedLimitProvider) Invalidate(identifier string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.cache, identifier)
+}
+
+func (c *CachedLimitProvider) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.refreshInterval {
+		return
+	}
+
+	for identifier, cached := range c.cache {
+		if now.Sub(cached.fetchedAt) >= c.refreshInterval {
+			delete(c.cache, identifier)
+		}
+	}
+	c.lastPrune = now
+}
@@ -0,0 +1,126 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitProvider(t *testing.T) {
+	plans := map[string]Limits{
+		"free":       {Limit: 1},
+		"enterprise": {Limit: 5, WindowSize: time.Hour},
+	}
+	provider := LimitProviderFunc(func(identifier string) Limits {
+		return plans[identifier]
+	})
+
+	t.Run("resolves limits per identifier", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategies := map[string]interface {
+			IsRequestAllowed(string) (bool, int)
+			SetLimitProvider(LimitProvider)
+			Stop()
+		}{
+			"fixed_window":           NewFixedWindowStrategy(3, time.Minute, mockTimeProvider),
+			"sliding_window_log":     NewSlidingWindowLogStrategy(3, time.Minute, mockTimeProvider),
+			"sliding_window_counter": NewSlidingWindowCountStrategy(3, time.Minute, mockTimeProvider),
+			"token_bucket":           NewTokenBucketStrategy(3, time.Minute, mockTimeProvider),
+			"calendar_quota":         NewCalendarQuotaStrategy(3, Day, time.UTC, mockTimeProvider),
+		}
+
+		for name, strategy := range strategies {
+			strategy.SetLimitProvider(provider)
+
+			if _, remaining := strategy.IsRequestAllowed("free"); remaining != 0 {
+				t.Errorf("%s: expected free plan to have 0 remaining got %d", name, remaining)
+			}
+			if _, remaining := strategy.IsRequestAllowed("enterprise"); remaining != 4 {
+				t.Errorf("%s: expected enterprise plan to have 4 remaining got %d", name, remaining)
+			}
+			if _, remaining := strategy.IsRequestAllowed("unknown"); remaining != 2 {
+				t.Errorf("%s: expected the default limit for unknown identifiers got %d", name, remaining)
+			}
+			strategy.Stop()
+		}
+	})
+
+	t.Run("resolves the window per identifier", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewFixedWindowStrategy(5, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+		strategy.SetLimitProvider(provider)
+
+		for range 5 {
+			strategy.IsRequestAllowed("enterprise")
+			strategy.IsRequestAllowed("unknown")
+		}
+
+		mockTimeProvider.Advance(time.Minute)
+		if allowed, _ := strategy.IsRequestAllowed("unknown"); !allowed {
+			t.Error("default window should have reset")
+		}
+		if allowed, _ := strategy.IsRequestAllowed("enterprise"); allowed {
+			t.Error("hourly window should not have reset")
+		}
+	})
+
+	t.Run("plan change takes effect without a new strategy", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewSlidingWindowLogStrategy(1, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+
+		plan := Limits{Limit: 1}
+		strategy.SetLimitProvider(LimitProviderFunc(func(identifier string) Limits {
+			return plan
+		}))
+
+		strategy.IsRequestAllowed("ege")
+		if allowed, _ := strategy.IsRequestAllowed("ege"); allowed {
+			t.Error("free plan should be exhausted")
+		}
+
+		plan = Limits{Limit: 3}
+		if allowed, remaining := strategy.IsRequestAllowed("ege"); !allowed || remaining != 1 {
+			t.Errorf("upgrade should apply immediately got %t %d", allowed, remaining)
+		}
+	})
+}
+
+func TestCachedLimitProvider(t *testing.T) {
+	t.Run("refreshes after the interval", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		calls := 0
+		plan := Limits{Limit: 1}
+		provider := NewCachedLimitProvider(LimitProviderFunc(func(identifier string) Limits {
+			calls++
+			return plan
+		}), time.Minute, mockTimeProvider)
+
+		provider.LimitsFor("ege")
+		plan = Limits{Limit: 10}
+		if limits := provider.LimitsFor("ege"); limits.Limit != 1 || calls != 1 {
+			t.Errorf("expected the cached limit got %d after %d calls", limits.Limit, calls)
+		}
+
+		mockTimeProvider.Advance(time.Minute)
+		if limits := provider.LimitsFor("ege"); limits.Limit != 10 || calls != 2 {
+			t.Errorf("expected the refreshed limit got %d after %d calls", limits.Limit, calls)
+		}
+	})
+
+	t.Run("invalidate forces a refresh", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		plan := Limits{Limit: 1}
+		provider := NewCachedLimitProvider(LimitProviderFunc(func(identifier string) Limits {
+			return plan
+		}), time.Hour, mockTimeProvider)
+
+		provider.LimitsFor("ege")
+		plan = Limits{Limit: 10}
+		provider.Invalidate("ege")
+
+		if limits := provider.LimitsFor("ege"); limits.Limit != 10 {
+			t.Errorf("expected the new plan after invalidate got %d", limits.Limit)
+		}
+	})
+}
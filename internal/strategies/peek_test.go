@@ -0,0 +1,81 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeekResetGrant(t *testing.T) {
+	for name, newStrategy := range testStrategies(3) {
+		t.Run(name+" peek does not consume", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			if allowed, remaining := strategy.Peek("ege"); !allowed || remaining != 3 {
+				t.Errorf("expected 3 remaining for a new identifier got %t %d", allowed, remaining)
+			}
+
+			for range 3 {
+				strategy.IsRequestAllowed("ege")
+			}
+
+			for range 3 {
+				if allowed, remaining := strategy.Peek("ege"); allowed || remaining != 0 {
+					t.Errorf("expected exhausted quota got %t %d", allowed, remaining)
+				}
+			}
+		})
+
+		t.Run(name+" reset clears the identifier", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			for range 3 {
+				strategy.IsRequestAllowed("ege")
+			}
+			strategy.Reset("ege")
+
+			if allowed, remaining := strategy.IsRequestAllowed("ege"); !allowed || remaining != 2 {
+				t.Errorf("expected a fresh quota after reset got %t %d", allowed, remaining)
+			}
+		})
+
+		t.Run(name+" grant adds capacity", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(mockTimeProvider)
+			defer strategy.Stop()
+
+			for range 3 {
+				strategy.IsRequestAllowed("ege")
+			}
+			strategy.Grant("ege", 2)
+
+			if allowed, remaining := strategy.Peek("ege"); !allowed || remaining != 2 {
+				t.Errorf("expected 2 granted requests got %t %d", allowed, remaining)
+			}
+			for i := range 2 {
+				if allowed, _ := strategy.IsRequestAllowed("ege"); !allowed {
+					t.Errorf("granted request %d should be allowed", i+1)
+				}
+			}
+			if allowed, _ := strategy.IsRequestAllowed("ege"); allowed {
+				t.Error("request past the grant should be rejected")
+			}
+		})
+	}
+}
+
+func TestGrantExpires(t *testing.T) {
+	mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	strategy := NewFixedWindowStrategy(3, time.Minute, mockTimeProvider)
+	defer strategy.Stop()
+
+	strategy.Grant("ege", 10)
+	mockTimeProvider.Advance(time.Minute)
+
+	if _, remaining := strategy.Peek("ege"); remaining != 3 {
+		t.Errorf("grant should expire with the window, got %d remaining", remaining)
+	}
+}
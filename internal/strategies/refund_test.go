@@ -0,0 +1,48 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefund(t *testing.T) {
+	type refundableStrategy interface {
+		IsRequestAllowed(identifier string) (bool, int)
+		Refund(identifier string, n int)
+		Stop()
+	}
+
+	newStrategies := map[string]func(tp TimeProvider) refundableStrategy{
+		"fair_share": func(tp TimeProvider) refundableStrategy { return NewFairShareStrategy(2, time.Minute, tp) },
+	}
+	for name, newStrategy := range testStrategies(2) {
+		newStrategies[name] = func(tp TimeProvider) refundableStrategy { return newStrategy(tp) }
+	}
+
+	for name, newStrategy := range newStrategies {
+		t.Run(name, func(t *testing.T) {
+			tp := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			strategy := newStrategy(tp)
+			defer strategy.Stop()
+
+			strategy.IsRequestAllowed("ege")
+			strategy.IsRequestAllowed("ege")
+			if ok, _ := strategy.IsRequestAllowed("ege"); ok {
+				t.Fatal("expected the limit to be used up")
+			}
+
+			strategy.Refund("ege", 1)
+			if ok, _ := strategy.IsRequestAllowed("ege"); !ok {
+				t.Error("expected the refunded request to be allowed again")
+			}
+			if ok, _ := strategy.IsRequestAllowed("ege"); ok {
+				t.Error("expected only one request to be refunded")
+			}
+
+			strategy.Refund("ege", 10)
+			if ok, remaining := strategy.IsRequestAllowed("ege"); !ok || remaining != 1 {
+				t.Errorf("expected refunds to stop at the full limit got %v, %d", ok, remaining)
+			}
+		})
+	}
+}
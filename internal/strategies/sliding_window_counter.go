@@ -1,8 +1,11 @@
 package strategies
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
 )
 
 type SlidingWindowCounterStrategy struct {
@@ -14,6 +17,10 @@ type SlidingWindowCounterStrategy struct {
 	cleanupInterval time.Duration
 	stopCleanup chan struct{}
 	cleanupDone chan struct{}
+	grants grantBook
+
+	keyLimit
+	limitSource
 }
 
 type Data struct {
@@ -27,9 +34,10 @@ func NewSlidingWindowCountStrategy(limit int, windowSize time.Duration, timeProv
 		windowSize: windowSize,
 		timeProvider: timeProvider,
 		storage: make(map[string]Data),
-		cleanupInterval: 185 * time.Second,
+		cleanupInterval: windowSize * 2,
 		cleanupDone: make(chan struct{}),
 		stopCleanup: make(chan struct{}),
+		grants: grantBook{},
 	}
 
 	go f.startCleanup()
@@ -39,49 +47,101 @@ func NewSlidingWindowCountStrategy(limit int, windowSize time.Duration, timeProv
 func (s *SlidingWindowCounterStrategy) IsRequestAllowed(identifier string) (bool, int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if !s.admit(identifier, s.evict) {
+		return false, 0
+	}
 
+	limits := s.limitsOf(identifier)
+	limit := s.limitFor(identifier, limits, s.timeProvider.Now())
 	data, exists := s.storage[identifier]
 	if !exists {
 		s.storage[identifier] = Data{currentWindow: WindowData{count: 1, timestamp: s.timeProvider.Now()}} 
-		return true, s.limit - 1
+		return true, limit - 1
 	}
 
-	currentWindowStart := s.timeProvider.Now().Truncate(s.windowSize)
+	currentWindowStart := s.timeProvider.Now().Truncate(limits.WindowSize)
 	if currentWindowStart.After(data.currentWindow.timestamp) {
 		data.prevWindow = data.currentWindow
 		data.currentWindow = WindowData{count: 1, timestamp: currentWindowStart}
 		s.storage[identifier] = data
-		return true, s.limit - 1
+		return true, limit - 1
 	}
 
 	timeElapsed := s.timeProvider.Now().Sub(currentWindowStart)
-	percentageElapsed := float64(timeElapsed) / float64(s.windowSize)
+	percentageElapsed := float64(timeElapsed) / float64(limits.WindowSize)
 	weight := 1.0 - percentageElapsed
 	weightedLimit := float64(data.prevWindow.count) * weight + float64(data.currentWindow.count)
 
-	if weightedLimit >= float64(s.limit) {
+	if weightedLimit >= float64(limit) {
 		return false, 0
 	} 
 
 
 	data.currentWindow.count++
 	s.storage[identifier] = data
-	remaining := s.limit - int(weightedLimit) - 1
+	remaining := limit - int(weightedLimit) - 1
 	return true, remaining
 
 }
 
+func (s *SlidingWindowCounterStrategy) Peek(identifier string) (bool, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.admits(identifier) {
+		return false, 0
+	}
+
+	state := s.keyState(identifier, s.timeProvider.Now())
+	return state.Remaining > 0, state.Remaining
+}
+
+// Grant adds n requests to identifier's limit until the current window ends.
+func (s *SlidingWindowCounterStrategy) Grant(identifier string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.admit(identifier, s.evict) {
+		return
+	}
+
+	now := s.timeProvider.Now()
+	windowSize := s.limitsOf(identifier).WindowSize
+	s.grants.add(identifier, n, now, now.Truncate(windowSize).Add(windowSize))
+}
+
+// Refund gives back n requests counted in the current window.
+func (s *SlidingWindowCounterStrategy) Refund(identifier string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.storage[identifier]
+	currentWindowStart := s.timeProvider.Now().Truncate(s.limitsOf(identifier).WindowSize)
+	if !exists || currentWindowStart.After(data.currentWindow.timestamp) {
+		return
+	}
+	data.currentWindow.count = max(data.currentWindow.count-n, 0)
+	s.storage[identifier] = data
+}
+
+func (s *SlidingWindowCounterStrategy) limitsOf(identifier string) Limits {
+	return s.resolve(identifier, Limits{Limit: s.limit, WindowSize: s.windowSize})
+}
+
+func (s *SlidingWindowCounterStrategy) limitFor(identifier string, limits Limits, now time.Time) int {
+	return limits.Limit + s.grants.extra(identifier, now)
+}
+
 func (s *SlidingWindowCounterStrategy) Stop() {
 	close(s.stopCleanup)
 	<-s.cleanupDone
 }
 
 func (s *SlidingWindowCounterStrategy) startCleanup() {
-	ticker := time.NewTicker(s.cleanupInterval)
+	ticker := clock.From(s.timeProvider).NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			s.cleanup()
 		case <-s.stopCleanup:
 			close(s.cleanupDone)
@@ -94,10 +154,118 @@ func (s * SlidingWindowCounterStrategy) cleanup() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	currentWindowStart := s.timeProvider.Now().Truncate(s.windowSize)
 	for identifier, data := range s.storage {
+		currentWindowStart := s.timeProvider.Now().Truncate(s.limitsOf(identifier).WindowSize)
 		if currentWindowStart.After(data.currentWindow.timestamp) {
 			delete(s.storage, identifier)
+			s.forget(identifier)
 		}
 	}
-}
\ No newline at end of file
+	s.grants.prune(s.timeProvider.Now())
+}
+
+func (s *SlidingWindowCounterStrategy) evict(identifier string) {
+	delete(s.storage, identifier)
+	delete(s.grants, identifier)
+}
+
+type counterState struct {
+	Current windowState `json:"current"`
+	Prev    windowState `json:"prev"`
+}
+
+func (s *SlidingWindowCounterStrategy) SaveState() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := make(map[string]counterState, len(s.storage))
+	for identifier, data := range s.storage {
+		state[identifier] = counterState{Current: newWindowState(data.currentWindow), Prev: newWindowState(data.prevWindow)}
+	}
+	return json.Marshal(state)
+}
+
+func (s *SlidingWindowCounterStrategy) LoadState(data []byte) error {
+	var state map[string]counterState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for identifier, counter := range state {
+		windowSize := s.limitsOf(identifier).WindowSize
+		previousWindowStart := s.timeProvider.Now().Truncate(windowSize).Add(-windowSize)
+		if counter.Current.Timestamp.Before(previousWindowStart) || !s.admit(identifier, s.evict) {
+			continue
+		}
+		s.storage[identifier] = Data{currentWindow: counter.Current.windowData(), prevWindow: counter.Prev.windowData()}
+	}
+	return nil
+}
+
+func (s *SlidingWindowCounterStrategy) Inspect() []KeyState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.timeProvider.Now()
+	states := make([]KeyState, 0, len(s.storage))
+	for identifier := range s.storage {
+		states = append(states, s.keyState(identifier, now))
+	}
+	return sortKeyStates(states)
+}
+
+func (s *SlidingWindowCounterStrategy) InspectKey(identifier string) (KeyState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.storage[identifier]
+	return s.keyState(identifier, s.timeProvider.Now()), exists
+}
+
+// keyState reports the weighted count the next request would be checked
+// against.
+func (s *SlidingWindowCounterStrategy) keyState(identifier string, now time.Time) KeyState {
+	limits := s.limitsOf(identifier)
+	currentWindowStart := now.Truncate(limits.WindowSize)
+	state := KeyState{Identifier: identifier, Limit: s.limitFor(identifier, limits, now), ResetAt: currentWindowStart.Add(limits.WindowSize)}
+
+	if data, exists := s.storage[identifier]; exists {
+		if currentWindowStart.After(data.currentWindow.timestamp) {
+			data.prevWindow = data.currentWindow
+			data.currentWindow = WindowData{timestamp: currentWindowStart}
+		}
+		weight := 1.0 - float64(now.Sub(currentWindowStart))/float64(limits.WindowSize)
+		state.Count = int(float64(data.prevWindow.count)*weight + float64(data.currentWindow.count))
+		if state.Count >= state.Limit {
+			state.RetryAt = retryAt(currentWindowStart, limits.WindowSize, data.prevWindow.count, data.currentWindow.count, state.Limit)
+		}
+	}
+	state.Remaining = max(state.Limit-state.Count, 0)
+	return state
+}
+
+// retryAt is when the previous window's weight has dropped far enough for
+// the weighted count to fall below limit, in the next window if the current
+// one is full on its own.
+func retryAt(windowStart time.Time, windowSize time.Duration, prev, current, limit int) time.Time {
+	if current >= limit {
+		windowStart, prev, current = windowStart.Add(windowSize), current, 0
+	}
+	if prev == 0 {
+		return windowStart
+	}
+	elapsed := 1 - float64(limit-current)/float64(prev)
+	return windowStart.Add(time.Duration(elapsed * float64(windowSize)))
+}
+
+func (s *SlidingWindowCounterStrategy) Reset(identifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.storage, identifier)
+	delete(s.grants, identifier)
+	s.forget(identifier)
+}
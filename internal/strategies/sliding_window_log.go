@@ -1,8 +1,11 @@
 package strategies
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
 )
 
 type SlidingWindowLogStrategy struct {
@@ -13,6 +16,10 @@ type SlidingWindowLogStrategy struct {
 	mu           sync.RWMutex
 	stopCleanup  chan struct{}
 	cleanupDone  chan struct{}
+	grants       grantBook
+
+	keyLimit
+	limitSource
 }
 
 type RealTimeProvider struct{}
@@ -29,6 +36,7 @@ func NewSlidingWindowLogStrategy(limit int, windowSize time.Duration, timeProvid
 		timeProvider: timeProvider,
 		stopCleanup:  make(chan struct{}),
 		cleanupDone:  make(chan struct{}),
+		grants:       grantBook{},
 	}
 
 	go strategy.startCleanup()
@@ -43,29 +51,75 @@ func (s *SlidingWindowLogStrategy) IsRequestAllowed(identifier string) (bool, in
 func (s *SlidingWindowLogStrategy) checkStorage(identifier string) (bool, int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if !s.admit(identifier, s.evict) {
+		return false, 0
+	}
 
+	limits := s.limitsOf(identifier)
+	limit := s.limitFor(identifier, limits, s.timeProvider.Now())
 	data, exists := s.storage[identifier]
 
 	if !exists {
 		data = append(data, s.timeProvider.Now())
 		s.storage[identifier] = data
-		return true, s.limit - 1
+		return true, limit - 1
 	}
 
-	newList := s.cleanStorage(data)
-	if len(newList) < s.limit {
+	newList := s.cleanStorage(data, limits.WindowSize)
+	if len(newList) < limit {
 		newList = append(newList, s.timeProvider.Now())
 		s.storage[identifier] = newList
-		return true, s.limit - len(newList)
+		return true, limit - len(newList)
 	}
 
 	return false, 0
 }
 
-func (s *SlidingWindowLogStrategy) cleanStorage(list []time.Time) []time.Time {
+func (s *SlidingWindowLogStrategy) Peek(identifier string) (bool, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.admits(identifier) {
+		return false, 0
+	}
+
+	state := s.keyState(identifier)
+	return state.Remaining > 0, state.Remaining
+}
+
+// Grant adds n requests to identifier's limit for the next window.
+func (s *SlidingWindowLogStrategy) Grant(identifier string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.admit(identifier, s.evict) {
+		return
+	}
+
+	now := s.timeProvider.Now()
+	s.grants.add(identifier, n, now, now.Add(s.limitsOf(identifier).WindowSize))
+}
+
+// Refund forgets the latest n requests of identifier's log.
+func (s *SlidingWindowLogStrategy) Refund(identifier string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data, exists := s.storage[identifier]; exists {
+		s.storage[identifier] = data[:max(len(data)-n, 0)]
+	}
+}
+
+func (s *SlidingWindowLogStrategy) limitsOf(identifier string) Limits {
+	return s.resolve(identifier, Limits{Limit: s.limit, WindowSize: s.windowSize})
+}
+
+func (s *SlidingWindowLogStrategy) limitFor(identifier string, limits Limits, now time.Time) int {
+	return limits.Limit + s.grants.extra(identifier, now)
+}
+
+func (s *SlidingWindowLogStrategy) cleanStorage(list []time.Time, windowSize time.Duration) []time.Time {
 	count := 0
 	for _, elm := range list {
-		if s.timeProvider.Now().After(elm.Add(s.windowSize)) {
+		if s.timeProvider.Now().After(elm.Add(windowSize)) {
 			count++
 		}
 	}
@@ -74,12 +128,12 @@ func (s *SlidingWindowLogStrategy) cleanStorage(list []time.Time) []time.Time {
 }
 
 func (s *SlidingWindowLogStrategy) startCleanup() {
-	ticker := time.NewTicker(time.Minute)
+	ticker := clock.From(s.timeProvider).NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			s.cleanup()
 		case <-s.stopCleanup:
 			close(s.cleanupDone)
@@ -93,16 +147,90 @@ func (s *SlidingWindowLogStrategy) cleanup() {
 	defer s.mu.Unlock()
 
 	for identifier, list := range s.storage {
-		newList := s.cleanStorage(list)
+		newList := s.cleanStorage(list, s.limitsOf(identifier).WindowSize)
 		if len(newList) == 0 {
 			delete(s.storage, identifier)
+			s.forget(identifier)
 		} else {
 			s.storage[identifier] = newList
 		}
 	}
+	s.grants.prune(s.timeProvider.Now())
+}
+
+func (s *SlidingWindowLogStrategy) evict(identifier string) {
+	delete(s.storage, identifier)
+	delete(s.grants, identifier)
+}
+
+func (s *SlidingWindowLogStrategy) SaveState() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return json.Marshal(s.storage)
+}
+
+func (s *SlidingWindowLogStrategy) LoadState(data []byte) error {
+	var state map[string][]time.Time
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for identifier, list := range state {
+		if newList := s.cleanStorage(list, s.limitsOf(identifier).WindowSize); len(newList) > 0 && s.admit(identifier, s.evict) {
+			s.storage[identifier] = newList
+		}
+	}
+	return nil
 }
 
 func (s *SlidingWindowLogStrategy) Stop() {
 	close(s.stopCleanup)
 	<-s.cleanupDone
 }
+
+func (s *SlidingWindowLogStrategy) Inspect() []KeyState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	states := make([]KeyState, 0, len(s.storage))
+	for identifier := range s.storage {
+		states = append(states, s.keyState(identifier))
+	}
+	return sortKeyStates(states)
+}
+
+func (s *SlidingWindowLogStrategy) InspectKey(identifier string) (KeyState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.storage[identifier]
+	return s.keyState(identifier), exists
+}
+
+// keyState reports when the oldest logged request leaves the window, which is
+// when the next slot frees up.
+func (s *SlidingWindowLogStrategy) keyState(identifier string) KeyState {
+	limits := s.limitsOf(identifier)
+	list := s.cleanStorage(s.storage[identifier], limits.WindowSize)
+	limit := s.limitFor(identifier, limits, s.timeProvider.Now())
+	state := KeyState{Identifier: identifier, Limit: limit, Count: len(list), Remaining: max(limit-len(list), 0)}
+	if len(list) > 0 {
+		state.ResetAt = list[0].Add(limits.WindowSize)
+	}
+	if state.Remaining == 0 && limit > 0 {
+		state.RetryAt = list[len(list)-limit].Add(limits.WindowSize)
+	}
+	return state
+}
+
+func (s *SlidingWindowLogStrategy) Reset(identifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.storage, identifier)
+	delete(s.grants, identifier)
+	s.forget(identifier)
+}
@@ -0,0 +1,16 @@
+package strategies
+
+import "time"
+
+type windowState struct {
+	Count     int       `json:"count"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func newWindowState(data WindowData) windowState {
+	return windowState{Count: data.count, Timestamp: data.timestamp}
+}
+
+func (w windowState) windowData() WindowData {
+	return WindowData{count: w.Count, timestamp: w.Timestamp}
+}
@@ -0,0 +1,53 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadState(t *testing.T) {
+	for name, newStrategy := range testStrategies(3) {
+		t.Run(name+" keeps quotas across a restart", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			before := newStrategy(mockTimeProvider)
+			for range 3 {
+				before.IsRequestAllowed("ege")
+			}
+			data, err := before.SaveState()
+			before.Stop()
+			if err != nil {
+				t.Fatalf("SaveState failed: %v", err)
+			}
+
+			mockTimeProvider.Advance(time.Second)
+			after := newStrategy(mockTimeProvider)
+			defer after.Stop()
+			if err := after.LoadState(data); err != nil {
+				t.Fatalf("LoadState failed: %v", err)
+			}
+
+			if allowed, _ := after.IsRequestAllowed("ege"); allowed {
+				t.Error("restored quota should still be exhausted")
+			}
+		})
+
+		t.Run(name+" discards entries that expired while down", func(t *testing.T) {
+			mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+			before := newStrategy(mockTimeProvider)
+			for range 3 {
+				before.IsRequestAllowed("ege")
+			}
+			data, _ := before.SaveState()
+			before.Stop()
+
+			mockTimeProvider.Advance(24 * time.Hour)
+			after := newStrategy(mockTimeProvider)
+			defer after.Stop()
+			after.LoadState(data)
+
+			if allowed, remaining := after.IsRequestAllowed("ege"); !allowed || remaining != 2 {
+				t.Errorf("expired entry should be dropped, got %t %d", allowed, remaining)
+			}
+		})
+	}
+}
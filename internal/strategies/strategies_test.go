@@ -0,0 +1,41 @@
+package strategies
+
+import "time"
+
+// testStrategy is implemented by every strategy that tracks a window per
+// identifier.
+type testStrategy interface {
+	IsRequestAllowed(identifier string) (bool, int)
+	Peek(identifier string) (bool, int)
+	Reset(identifier string)
+	Grant(identifier string, n int)
+	Refund(identifier string, n int)
+	Inspect() []KeyState
+	InspectKey(identifier string) (KeyState, bool)
+	SaveState() ([]byte, error)
+	LoadState(data []byte) error
+	SetKeyLimit(maxKeys int, policy EvictionPolicy)
+	Stop()
+}
+
+// testStrategies builds each of them with limit requests per minute, or per
+// day for calendar_quota.
+func testStrategies(limit int) map[string]func(timeProvider TimeProvider) testStrategy {
+	return map[string]func(timeProvider TimeProvider) testStrategy{
+		"fixed_window": func(timeProvider TimeProvider) testStrategy {
+			return NewFixedWindowStrategy(limit, time.Minute, timeProvider)
+		},
+		"sliding_window_log": func(timeProvider TimeProvider) testStrategy {
+			return NewSlidingWindowLogStrategy(limit, time.Minute, timeProvider)
+		},
+		"sliding_window_counter": func(timeProvider TimeProvider) testStrategy {
+			return NewSlidingWindowCountStrategy(limit, time.Minute, timeProvider)
+		},
+		"token_bucket": func(timeProvider TimeProvider) testStrategy {
+			return NewTokenBucketStrategy(limit, time.Minute, timeProvider)
+		},
+		"calendar_quota": func(timeProvider TimeProvider) testStrategy {
+			return NewCalendarQuotaStrategy(limit, Day, time.UTC, timeProvider)
+		},
+	}
+}
@@ -0,0 +1,315 @@
+package strategies
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type TokenBucketStrategy struct {
+	limit        int
+	windowSize   time.Duration
+	storage      map[string]BucketData
+	grants       grantBook
+	timeProvider TimeProvider
+	mu           sync.Mutex
+
+	stopCleanup     chan struct{}
+	cleanupDone     chan struct{}
+	cleanupInterval time.Duration
+
+	keyLimit
+	limitSource
+}
+
+type BucketData struct {
+	tokens    float64
+	timestamp time.Time
+}
+
+// NewTokenBucketStrategy refills limit tokens per windowSize, continuously,
+// and lets a bucket hold at most limit tokens.
+func NewTokenBucketStrategy(limit int, windowSize time.Duration, timeProvider TimeProvider) *TokenBucketStrategy {
+	t := &TokenBucketStrategy{
+		limit:           limit,
+		windowSize:      windowSize,
+		storage:         map[string]BucketData{},
+		grants:          grantBook{},
+		timeProvider:    timeProvider,
+		cleanupInterval: windowSize * 2,
+		stopCleanup:     make(chan struct{}),
+		cleanupDone:     make(chan struct{}),
+	}
+
+	go t.startCleanup()
+	return t
+}
+
+func (t *TokenBucketStrategy) IsRequestAllowed(identifier string) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.admit(identifier, t.evict) {
+		return false, 0
+	}
+
+	now := t.timeProvider.Now()
+	data := t.refill(identifier, now)
+	t.storage[identifier] = data
+
+	// Granted tokens are spent first, before they expire.
+	if extra := t.grants.extra(identifier, now); extra > 0 {
+		t.grants.spend(identifier)
+		return true, max(int(data.tokens), 0) + extra - 1
+	}
+	if data.tokens < 1 {
+		return false, 0
+	}
+
+	data.tokens--
+	t.storage[identifier] = data
+	return true, int(data.tokens)
+}
+
+func (t *TokenBucketStrategy) Peek(identifier string) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.admits(identifier) {
+		return false, 0
+	}
+
+	state := t.keyState(identifier, t.timeProvider.Now())
+	return state.Remaining > 0, state.Remaining
+}
+
+// Grant gives identifier n extra tokens on top of its bucket for as long as
+// the bucket takes to refill completely. They are gone once spent.
+func (t *TokenBucketStrategy) Grant(identifier string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.admit(identifier, t.evict) {
+		return
+	}
+
+	now := t.timeProvider.Now()
+	t.grants.add(identifier, n, now, now.Add(t.limitsOf(identifier).WindowSize))
+}
+
+// Reserve takes n tokens even if the bucket does not hold them yet and
+// returns how long the caller has to wait until the debt is paid off.
+func (t *TokenBucketStrategy) Reserve(identifier string, n int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.admit(identifier, t.evict) {
+		// Untracked identifiers get no burst, only the steady rate.
+		return t.durationFor(t.limitsOf(identifier), float64(n))
+	}
+
+	data := t.refill(identifier, t.timeProvider.Now())
+	data.tokens -= float64(n)
+	t.storage[identifier] = data
+
+	if data.tokens >= 0 {
+		return 0
+	}
+	return t.durationFor(t.limitsOf(identifier), -data.tokens)
+}
+
+// Release gives back n tokens taken by a reservation that was not used.
+// Tokens that do not fit into the bucket go back to a running grant.
+func (t *TokenBucketStrategy) Release(identifier string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.release(identifier, n, t.timeProvider.Now())
+}
+
+// Refund puts back n tokens taken by requests that should not count. Tokens
+// paid by a grant go back to the grant.
+func (t *TokenBucketStrategy) Refund(identifier string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.timeProvider.Now()
+	n -= t.grants.refund(identifier, n, now)
+	t.release(identifier, n, now)
+}
+
+func (t *TokenBucketStrategy) release(identifier string, n int, now time.Time) {
+	if _, exists := t.storage[identifier]; !exists || n <= 0 {
+		return
+	}
+	data := t.refill(identifier, now)
+	limit := float64(t.limitsOf(identifier).Limit)
+	overflow := int(data.tokens + float64(n) - limit)
+	data.tokens = min(data.tokens+float64(n), limit)
+	t.storage[identifier] = data
+
+	if extra := t.grants.extra(identifier, now); overflow > 0 && extra > 0 {
+		granted := t.grants[identifier]
+		granted.n += overflow
+		t.grants[identifier] = granted
+	}
+}
+
+func (t *TokenBucketStrategy) evict(identifier string) {
+	delete(t.storage, identifier)
+	delete(t.grants, identifier)
+}
+
+func (t *TokenBucketStrategy) limitsOf(identifier string) Limits {
+	return t.resolve(identifier, Limits{Limit: t.limit, WindowSize: t.windowSize})
+}
+
+func (t *TokenBucketStrategy) refill(identifier string, now time.Time) BucketData {
+	limits := t.limitsOf(identifier)
+	data, exists := t.storage[identifier]
+	if !exists {
+		return BucketData{tokens: float64(limits.Limit), timestamp: now}
+	}
+
+	elapsed := now.Sub(data.timestamp)
+	if elapsed > 0 {
+		data.tokens = min(data.tokens+t.tokensFor(limits, elapsed), float64(limits.Limit))
+		data.timestamp = now
+	}
+	return data
+}
+
+func (t *TokenBucketStrategy) tokensFor(limits Limits, elapsed time.Duration) float64 {
+	return float64(elapsed) / float64(limits.WindowSize) * float64(limits.Limit)
+}
+
+func (t *TokenBucketStrategy) durationFor(limits Limits, tokens float64) time.Duration {
+	return time.Duration(tokens / float64(limits.Limit) * float64(limits.WindowSize))
+}
+
+type bucketState struct {
+	Tokens    float64   `json:"tokens"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (t *TokenBucketStrategy) SaveState() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := make(map[string]bucketState, len(t.storage))
+	for identifier, data := range t.storage {
+		state[identifier] = bucketState{Tokens: data.tokens, Timestamp: data.timestamp}
+	}
+	return json.Marshal(state)
+}
+
+func (t *TokenBucketStrategy) LoadState(data []byte) error {
+	var state map[string]bucketState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.timeProvider.Now()
+	for identifier, bucket := range state {
+		t.storage[identifier] = BucketData{tokens: bucket.Tokens, timestamp: bucket.Timestamp}
+		if t.full(identifier, now) || !t.admit(identifier, t.evict) {
+			delete(t.storage, identifier)
+		}
+	}
+	return nil
+}
+
+func (t *TokenBucketStrategy) Stop() {
+	close(t.stopCleanup)
+	<-t.cleanupDone
+}
+
+func (t *TokenBucketStrategy) startCleanup() {
+	ticker := clock.From(t.timeProvider).NewTicker(t.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			t.cleanup()
+		case <-t.stopCleanup:
+			close(t.cleanupDone)
+			return
+		}
+	}
+}
+
+func (t *TokenBucketStrategy) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.timeProvider.Now()
+	for identifier := range t.storage {
+		if t.full(identifier, now) && t.grants.extra(identifier, now) == 0 {
+			delete(t.storage, identifier)
+			t.forget(identifier)
+		}
+	}
+	t.grants.prune(now)
+}
+
+// full reports whether identifier's bucket has refilled, so forgetting it
+// loses nothing.
+func (t *TokenBucketStrategy) full(identifier string, now time.Time) bool {
+	return t.refill(identifier, now).tokens >= float64(t.limitsOf(identifier).Limit)
+}
+
+func (t *TokenBucketStrategy) getStorageSize() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.storage)
+}
+
+func (t *TokenBucketStrategy) Inspect() []KeyState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.timeProvider.Now()
+	states := make([]KeyState, 0, len(t.storage))
+	for identifier := range t.storage {
+		states = append(states, t.keyState(identifier, now))
+	}
+	return sortKeyStates(states)
+}
+
+func (t *TokenBucketStrategy) InspectKey(identifier string) (KeyState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, exists := t.storage[identifier]
+	return t.keyState(identifier, t.timeProvider.Now()), exists
+}
+
+// keyState counts spent tokens and reports when the bucket is full again and
+// when the next token is due.
+func (t *TokenBucketStrategy) keyState(identifier string, now time.Time) KeyState {
+	limits := t.limitsOf(identifier)
+	data := t.refill(identifier, now)
+	remaining := max(int(data.tokens), 0) + t.grants.extra(identifier, now)
+	state := KeyState{
+		Identifier: identifier,
+		Count:      max(limits.Limit-remaining, 0),
+		Limit:      max(limits.Limit, remaining),
+		Remaining:  remaining,
+		ResetAt:    now.Add(max(t.durationFor(limits, float64(limits.Limit)-data.tokens), 0)),
+	}
+	if remaining == 0 {
+		state.RetryAt = now.Add(t.durationFor(limits, 1-data.tokens))
+	}
+	return state
+}
+
+func (t *TokenBucketStrategy) Reset(identifier string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.storage, identifier)
+	delete(t.grants, identifier)
+	t.forget(identifier)
+}
@@ -0,0 +1,150 @@
+package strategies
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketStrategy(t *testing.T) {
+	t.Run("allows a burst up to the limit", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		for i := range 10 {
+			if allowed, _ := strategy.IsRequestAllowed("ege"); !allowed {
+				t.Errorf("%dth request should be allowed", i+1)
+			}
+		}
+
+		if allowed, _ := strategy.IsRequestAllowed("ege"); allowed {
+			t.Error("11th request should not be allowed")
+		}
+	})
+
+	t.Run("refills tokens continuously", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		for range 10 {
+			strategy.IsRequestAllowed("ege")
+		}
+
+		mockTimeProvider.Advance(300 * time.Millisecond)
+
+		allowed, remaining := strategy.IsRequestAllowed("ege")
+		if !allowed || remaining != 2 {
+			t.Errorf("expected allowed with 2 remaining got %t %d", allowed, remaining)
+		}
+	})
+
+	t.Run("reserve returns the time needed to pay off the debt", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(100, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		if delay := strategy.Reserve("ege", 100); delay != 0 {
+			t.Errorf("reservation within the burst should not wait got %v", delay)
+		}
+
+		if delay := strategy.Reserve("ege", 50); delay != 500*time.Millisecond {
+			t.Errorf("expected 500ms delay got %v", delay)
+		}
+
+		strategy.Release("ege", 50)
+
+		if delay := strategy.Reserve("ege", 10); delay != 100*time.Millisecond {
+			t.Errorf("released tokens should be reusable, expected 100ms delay got %v", delay)
+		}
+	})
+
+	t.Run("cleanup removes full buckets", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.IsRequestAllowed("old-user")
+		mockTimeProvider.Advance(time.Second)
+		strategy.IsRequestAllowed("new-user")
+
+		strategy.cleanup()
+
+		if strategy.getStorageSize() != 1 {
+			t.Errorf("Should have 1 entry got %d", strategy.getStorageSize())
+		}
+	})
+	t.Run("granted buckets are removed once idle", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.Grant("ege", 5)
+		strategy.IsRequestAllowed("ege")
+		mockTimeProvider.Advance(time.Second)
+		strategy.cleanup()
+
+		if strategy.getStorageSize() != 0 {
+			t.Errorf("expected the idle bucket to be removed got %d entries", strategy.getStorageSize())
+		}
+		if _, remaining := strategy.Peek("ege"); remaining != 10 {
+			t.Errorf("expected the grant to expire after a full refill got %d remaining", remaining)
+		}
+	})
+
+	t.Run("refunds keep granted tokens", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(2, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.Grant("ege", 3)
+		strategy.IsRequestAllowed("ege")
+		strategy.Refund("ege", 1)
+
+		if _, remaining := strategy.Peek("ege"); remaining != 5 {
+			t.Errorf("expected the full bucket and the grant to remain got %d", remaining)
+		}
+	})
+
+	t.Run("refunds of granted requests go back to the grant", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Minute, mockTimeProvider)
+		defer strategy.Stop()
+
+		strategy.Grant("ege", 1)
+		for range 5 {
+			strategy.IsRequestAllowed("ege")
+		}
+		strategy.Refund("ege", 1)
+
+		if tokens := strategy.storage["ege"].tokens; tokens != 6 {
+			t.Errorf("expected the bucket to keep its 6 tokens got %v", tokens)
+		}
+		if extra := strategy.grants.extra("ege", mockTimeProvider.Now()); extra != 1 {
+			t.Errorf("expected the refund to restore the grant got %d", extra)
+		}
+		allowed := 0
+		for range 20 {
+			if ok, _ := strategy.IsRequestAllowed("ege"); ok {
+				allowed++
+			}
+		}
+		if allowed != 7 {
+			t.Errorf("expected 11 admissions in total, got %d more after the first 4", allowed)
+		}
+	})
+
+	t.Run("full snapshots are skipped on load", func(t *testing.T) {
+		mockTimeProvider := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+		strategy := NewTokenBucketStrategy(10, time.Second, mockTimeProvider)
+		defer strategy.Stop()
+
+		state := []byte(`{"ege": {"tokens": 15, "timestamp": "2024-01-01T11:00:00Z"}}`)
+		if err := strategy.LoadState(state); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if strategy.getStorageSize() != 0 {
+			t.Errorf("expected an overfilled bucket to be skipped got %d entries", strategy.getStorageSize())
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+const defaultTop = 10
+
+// Handler exposes live limiter state over HTTP. Mount it under a prefix with
+// http.StripPrefix:
+//
+//	GET    /policies                            active policies
+//	GET    /policies/{policy}/keys              tracked identifiers
+//	GET    /policies/{policy}/keys/{key}        state of one identifier
+//	DELETE /policies/{policy}/keys/{key}        reset one identifier
+//	POST   /policies/{policy}/keys/{key}/grant  temporarily raise its limit by ?n=
+//	GET    /policies/{policy}/top?n=10          identifiers with the highest counts
+//
+// None of the endpoints consume quota.
+type Handler struct {
+	// Authorize is consulted before every request, requests it refuses are
+	// answered with 401. All requests are allowed when it is nil.
+	Authorize func(r *http.Request) bool
+
+	policies map[string]*ratelimiter.Ratelimiter
+	names    []string
+	mux      *http.ServeMux
+}
+
+type policyResponse struct {
+	Name             string `json:"name"`
+	Strategy         string `json:"strategy"`
+	TrackedKeys      int    `json:"tracked_keys"`
+	Evictions        int64  `json:"evictions"`
+	ShadowRejections int64  `json:"shadow_rejections"`
+	Degraded         bool   `json:"degraded"`
+}
+
+type keyResponse struct {
+	Identifier string    `json:"identifier"`
+	Tracked    bool      `json:"tracked"`
+	Count      int       `json:"count"`
+	Limit      int       `json:"limit"`
+	Remaining  int       `json:"remaining"`
+	ResetAt    time.Time `json:"reset_at"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler fails if two policies share a name, give them distinct
+// Config.Name values.
+func NewHandler(policies ...*ratelimiter.Ratelimiter) (*Handler, error) {
+	h := &Handler{
+		policies: map[string]*ratelimiter.Ratelimiter{},
+		mux:      http.NewServeMux(),
+	}
+	for _, policy := range policies {
+		if _, exists := h.policies[policy.Name()]; exists {
+			return nil, fmt.Errorf("duplicate policy name %q", policy.Name())
+		}
+		h.policies[policy.Name()] = policy
+		h.names = append(h.names, policy.Name())
+	}
+
+	h.mux.HandleFunc("GET /policies", h.listPolicies)
+	h.mux.HandleFunc("GET /policies/{policy}/keys", h.listKeys)
+	h.mux.HandleFunc("GET /policies/{policy}/keys/{key}", h.showKey)
+	h.mux.HandleFunc("DELETE /policies/{policy}/keys/{key}", h.resetKey)
+	h.mux.HandleFunc("POST /policies/{policy}/keys/{key}/grant", h.grantKey)
+	h.mux.HandleFunc("GET /policies/{policy}/top", h.topKeys)
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize != nil && !h.Authorize(r) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) listPolicies(w http.ResponseWriter, r *http.Request) {
+	policies := make([]policyResponse, 0, len(h.names))
+	for _, name := range h.names {
+		policy := h.policies[name]
+		states, _ := policy.Inspect()
+		policies = append(policies, policyResponse{
+			Name:             name,
+			Strategy:         policy.StrategyName(),
+			TrackedKeys:      len(states),
+			Evictions:        policy.Evictions(),
+			ShadowRejections: policy.ShadowRejections(),
+			Degraded:         policy.Degraded(),
+		})
+	}
+	writeJSON(w, http.StatusOK, policies)
+}
+
+func (h *Handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policy(w, r)
+	if !ok {
+		return
+	}
+
+	states, err := policy.Inspect()
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, keyResponses(states))
+}
+
+func (h *Handler) showKey(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policy(w, r)
+	if !ok {
+		return
+	}
+
+	state, tracked, err := policy.InspectKey(r.PathValue("key"))
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, errorResponse{Error: err.Error()})
+		return
+	}
+	response := newKeyResponse(state)
+	response.Tracked = tracked
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) resetKey(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policy(w, r)
+	if !ok {
+		return
+	}
+
+	policy.Reset(r.PathValue("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) grantKey(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policy(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 1 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "n must be a positive integer"})
+		return
+	}
+
+	policy.Grant(r.PathValue("key"), n)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) topKeys(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policy(w, r)
+	if !ok {
+		return
+	}
+
+	n := defaultTop
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "n must be a positive integer"})
+			return
+		}
+		n = parsed
+	}
+
+	states, err := policy.Top(n)
+	if err != nil {
+		writeJSON(w, http.StatusNotImplemented, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, keyResponses(states))
+}
+
+func (h *Handler) policy(w http.ResponseWriter, r *http.Request) (*ratelimiter.Ratelimiter, bool) {
+	policy, exists := h.policies[r.PathValue("policy")]
+	if !exists {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "unknown policy " + r.PathValue("policy")})
+	}
+	return policy, exists
+}
+
+func newKeyResponse(state strategies.KeyState) keyResponse {
+	return keyResponse{
+		Identifier: state.Identifier,
+		Tracked:    true,
+		Count:      state.Count,
+		Limit:      state.Limit,
+		Remaining:  state.Remaining,
+		ResetAt:    state.ResetAt,
+	}
+}
+
+func keyResponses(states []strategies.KeyState) []keyResponse {
+	responses := make([]keyResponse, 0, len(states))
+	for _, state := range states {
+		responses = append(responses, newKeyResponse(state))
+	}
+	return responses
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+)
+
+func newTestHandler(t *testing.T) (*Handler, *ratelimiter.Ratelimiter) {
+	t.Helper()
+
+	rl := ratelimiter.NewRatelimiterWithConfig(&ratelimiter.Config{
+		Name:       "api",
+		Strategy:   "fixed_window",
+		Limit:      10,
+		WindowSize: time.Minute,
+	})
+	t.Cleanup(rl.Stop)
+
+	for range 3 {
+		rl.IsRequestAllowed("heavy")
+	}
+	rl.IsRequestAllowed("light")
+
+	handler, err := NewHandler(rl)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return handler, rl
+}
+
+func get(t *testing.T, handler http.Handler, target string, body any) int {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	if body != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+			t.Fatalf("invalid json from %s: %v", target, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAdminHandler(t *testing.T) {
+	t.Run("lists policies", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		var policies []policyResponse
+		get(t, handler, "/policies", &policies)
+
+		if len(policies) != 1 || policies[0].Name != "api" || policies[0].Strategy != "fixed_window" || policies[0].TrackedKeys != 2 {
+			t.Errorf("unexpected policies %+v", policies)
+		}
+	})
+
+	t.Run("lists keys", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		var keys []keyResponse
+		get(t, handler, "/policies/api/keys", &keys)
+
+		if len(keys) != 2 || keys[0].Identifier != "heavy" || keys[0].Count != 3 || keys[0].Remaining != 7 {
+			t.Errorf("unexpected keys %+v", keys)
+		}
+	})
+
+	t.Run("shows one key without consuming quota", func(t *testing.T) {
+		handler, rl := newTestHandler(t)
+
+		var key keyResponse
+		for range 2 {
+			get(t, handler, "/policies/api/keys/heavy", &key)
+		}
+
+		if !key.Tracked || key.Count != 3 {
+			t.Errorf("unexpected key %+v", key)
+		}
+		if _, remaining := rl.IsRequestAllowed("heavy"); remaining != 6 {
+			t.Errorf("inspection should not consume quota, remaining %d", remaining)
+		}
+	})
+
+	t.Run("resets a key", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("DELETE", "/policies/api/keys/heavy", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d", rec.Code)
+		}
+
+		var key keyResponse
+		get(t, handler, "/policies/api/keys/heavy", &key)
+		if key.Tracked || key.Count != 0 {
+			t.Errorf("expected key to be reset got %+v", key)
+		}
+	})
+
+	t.Run("grants extra capacity", func(t *testing.T) {
+		handler, rl := newTestHandler(t)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/policies/api/keys/heavy/grant?n=5", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected 204, got %d", rec.Code)
+		}
+
+		if decision := rl.Peek("heavy"); decision.Remaining != 12 {
+			t.Errorf("expected 12 remaining after the grant got %d", decision.Remaining)
+		}
+	})
+
+	t.Run("shows the heaviest keys", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		var keys []keyResponse
+		get(t, handler, "/policies/api/top?n=1", &keys)
+
+		if len(keys) != 1 || keys[0].Identifier != "heavy" {
+			t.Errorf("expected heavy to be on top got %+v", keys)
+		}
+
+		if code := get(t, handler, "/policies/api/top?n=zero", nil); code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", code)
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+
+		if code := get(t, handler, "/policies/missing/keys", nil); code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", code)
+		}
+	})
+
+	t.Run("auth hook", func(t *testing.T) {
+		handler, _ := newTestHandler(t)
+		handler.Authorize = func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer secret"
+		}
+
+		if code := get(t, handler, "/policies", nil); code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", code)
+		}
+
+		req := httptest.NewRequest("GET", "/policies", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("duplicate policy names", func(t *testing.T) {
+		_, rl := newTestHandler(t)
+
+		if _, err := NewHandler(rl, rl); err == nil {
+			t.Error("expected an error for two policies named api")
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Fake only moves when Advance is called. Advance fires every timer and
+// ticker that is due and waits until each due tick has been received, so
+// once it returns the goroutine behind a ticker has woken up. Stopping that
+// goroutine afterwards waits for the work the tick triggered.
+//
+// A ticker that is neither read nor stopped blocks Advance.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	now := f.now
+
+	var ticks []*fakeWaiter
+	active := f.waiters[:0]
+	for _, waiter := range f.waiters {
+		switch {
+		case waiter.deadline.After(now):
+			active = append(active, waiter)
+		case waiter.period > 0:
+			// Like time.Ticker, ticks missed by a long Advance are dropped.
+			for !waiter.deadline.After(now) {
+				waiter.deadline = waiter.deadline.Add(waiter.period)
+			}
+			active = append(active, waiter)
+			ticks = append(ticks, waiter)
+		default:
+			select {
+			case waiter.ch <- now:
+			default:
+			}
+		}
+	}
+	clear(f.waiters[len(active):])
+	f.waiters = active
+	f.changed.Broadcast()
+	f.mu.Unlock()
+
+	for _, waiter := range ticks {
+		select {
+		case waiter.ch <- now:
+		case <-waiter.stopped:
+		}
+	}
+}
+
+// BlockUntil waits until n timers and tickers are active, for example until
+// a goroutine under test has started waiting on the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	waiter := &fakeWaiter{clock: f, ch: make(chan time.Time), period: d, stopped: make(chan struct{})}
+	f.add(waiter, d)
+	return fakeTicker{waiter}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	waiter := &fakeWaiter{clock: f, ch: make(chan time.Time, 1)}
+	f.add(waiter, d)
+	return waiter
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *Fake) add(waiter *fakeWaiter, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	waiter.deadline = f.now.Add(d)
+	if d <= 0 && waiter.period == 0 {
+		select {
+		case waiter.ch <- f.now:
+		default:
+		}
+		return
+	}
+	f.waiters = append(f.waiters, waiter)
+	f.changed.Broadcast()
+}
+
+// remove reports whether waiter was still active.
+func (f *Fake) remove(waiter *fakeWaiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := slices.Index(f.waiters, waiter)
+	if i < 0 {
+		return false
+	}
+	f.waiters = slices.Delete(f.waiters, i, i+1)
+	f.changed.Broadcast()
+	return true
+}
+
+type fakeWaiter struct {
+	clock    *Fake
+	ch       chan time.Time
+	deadline time.Time
+	period   time.Duration
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+func (w *fakeWaiter) Stop() bool {
+	active := w.clock.remove(w)
+	if w.stopped != nil {
+		w.stopOnce.Do(func() { close(w.stopped) })
+	}
+	return active
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	active := w.clock.remove(w)
+	w.clock.add(w, d)
+	return active
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
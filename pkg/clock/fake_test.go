@@ -0,0 +1,135 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("timer fires once its deadline passes", func(t *testing.T) {
+		clock := NewFake(start)
+		timer := clock.NewTimer(time.Minute)
+
+		clock.Advance(59 * time.Second)
+		select {
+		case <-timer.C():
+			t.Fatal("timer fired early")
+		default:
+		}
+
+		clock.Advance(time.Second)
+		select {
+		case fired := <-timer.C():
+			if !fired.Equal(start.Add(time.Minute)) {
+				t.Errorf("expected the timer to fire at %v got %v", start.Add(time.Minute), fired)
+			}
+		default:
+			t.Fatal("timer should have fired")
+		}
+
+		if timer.Stop() {
+			t.Error("a fired timer is no longer active")
+		}
+	})
+
+	t.Run("stopped and reset timers", func(t *testing.T) {
+		clock := NewFake(start)
+		timer := clock.NewTimer(time.Minute)
+
+		if !timer.Stop() {
+			t.Error("stopping an active timer should report true")
+		}
+		clock.Advance(time.Minute)
+		select {
+		case <-timer.C():
+			t.Fatal("stopped timer fired")
+		default:
+		}
+
+		timer.Reset(time.Second)
+		clock.Advance(time.Second)
+		select {
+		case <-timer.C():
+		default:
+			t.Fatal("reset timer should have fired")
+		}
+	})
+
+	t.Run("after", func(t *testing.T) {
+		clock := NewFake(start)
+		after := clock.After(time.Hour)
+
+		clock.Advance(2 * time.Hour)
+		select {
+		case <-after:
+		default:
+			t.Fatal("after should have fired")
+		}
+	})
+
+	t.Run("advance waits for the ticker to be received", func(t *testing.T) {
+		clock := NewFake(start)
+		ticker := clock.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		advanced := make(chan struct{})
+		go func() {
+			clock.Advance(time.Minute)
+			close(advanced)
+		}()
+
+		select {
+		case <-advanced:
+			t.Fatal("advance returned before the tick was received")
+		case <-time.After(10 * time.Millisecond):
+		}
+		<-ticker.C()
+		<-advanced
+
+		// Ticks missed during a long advance are dropped, like time.Ticker.
+		go clock.Advance(5 * time.Minute)
+		if tick := <-ticker.C(); !tick.Equal(start.Add(6 * time.Minute)) {
+			t.Errorf("expected one tick at %v got %v", start.Add(6*time.Minute), tick)
+		}
+	})
+
+	t.Run("advance does not wait for stopped tickers", func(t *testing.T) {
+		clock := NewFake(start)
+		ticker := clock.NewTicker(time.Minute)
+		ticker.Stop()
+
+		clock.Advance(time.Hour)
+	})
+
+	t.Run("block until waits for waiters", func(t *testing.T) {
+		clock := NewFake(start)
+		fired := make(chan struct{})
+		go func() {
+			<-clock.After(time.Second)
+			close(fired)
+		}()
+
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		<-fired
+	})
+}
+
+func TestFrom(t *testing.T) {
+	fake := NewFake(time.Now())
+	if From(fake) != Clock(fake) {
+		t.Error("a clock should be used as is")
+	}
+
+	if _, ok := From(&nowOnly{}).(Real); !ok {
+		t.Error("providers without timers should fall back to real time")
+	}
+}
+
+type nowOnly struct{}
+
+func (nowOnly) Now() time.Time {
+	return time.Time{}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func TestMiddlewareAccessList(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	t.Run("allow listed clients are never throttled", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		list, _ := accesslist.New([]string{"192.0.2.0/24"}, nil)
+		middleware := Middleware{Ratelimiter: rl, AccessList: list}
+
+		next := middleware.RateLimitMiddleware(handler)
+
+		for range 3 {
+			req := httptest.NewRequest("GET", "/test", nil)
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected 200, got %d", rec.Code)
+			}
+		}
+	})
+
+	t.Run("deny listed clients are always blocked", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(10, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		list, _ := accesslist.New(nil, []string{"192.0.2.1"})
+		middleware := Middleware{Ratelimiter: rl, AccessList: list}
+
+		next := middleware.RateLimitMiddleware(handler)
+
+		req := httptest.NewRequest("GET", "/test", nil)
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/bandwidth"
+)
+
+type BandwidthMiddleware struct {
+	Upload   *bandwidth.Limiter
+	Download *bandwidth.Limiter
+}
+
+func (m *BandwidthMiddleware) ThrottleMiddleware(next http.HandlerFunc) http.HandlerFunc {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		identifier := clientIP(r)
+
+		if m.Upload != nil && r.Body != nil {
+			r.Body = m.Upload.NewReadCloser(r.Context(), identifier, r.Body)
+		}
+		if m.Download != nil {
+			w = m.Download.NewResponseWriter(r.Context(), identifier, w)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
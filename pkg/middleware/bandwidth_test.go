@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/bandwidth"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func TestBandwidthMiddleware(t *testing.T) {
+	t.Run("request and response bodies pass through", func(t *testing.T) {
+		middleware := BandwidthMiddleware{
+			Upload:   bandwidth.NewLimiter(1<<20, &strategies.RealTimeProvider{}),
+			Download: bandwidth.NewLimiter(1<<20, &strategies.RealTimeProvider{}),
+		}
+		defer middleware.Upload.Stop()
+		defer middleware.Download.Stop()
+
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}
+
+		next := middleware.ThrottleMiddleware(handler)
+
+		req := httptest.NewRequest("POST", "/upload", strings.NewReader("payload"))
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+
+		if rec.Body.String() != "payload" {
+			t.Errorf("expected echoed body got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("download stops at the budget once the client goes away", func(t *testing.T) {
+		middleware := BandwidthMiddleware{
+			Download: bandwidth.NewLimiter(10, &strategies.RealTimeProvider{}),
+		}
+		defer middleware.Download.Stop()
+
+		var writeErr error
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			_, writeErr = w.Write([]byte(strings.Repeat("a", 100)))
+		}
+
+		next := middleware.ThrottleMiddleware(handler)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest("GET", "/download", nil).WithContext(ctx)
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+
+		if writeErr == nil {
+			t.Error("expected the throttled write to fail")
+		}
+		if rec.Body.Len() != 10 {
+			t.Errorf("expected only the 10 byte budget to be written got %d", rec.Body.Len())
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+)
+
+type failingLimiter struct {
+	err error
+}
+
+func (f *failingLimiter) IsRequestAllowed(identifier string) (bool, int) {
+	return false, 0
+}
+
+func (f *failingLimiter) Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error) {
+	return ratelimiter.Decision{}, f.err
+}
+
+func (f *failingLimiter) Stop() {}
+
+func TestMiddlewareLimiterErrors(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	t.Run("failing limiter returns 503", func(t *testing.T) {
+		middleware := Middleware{Ratelimiter: &failingLimiter{err: errors.New("backend down")}}
+
+		rec := httptest.NewRecorder()
+		middleware.RateLimitMiddleware(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/test", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503, got %d", rec.Code)
+		}
+	})
+
+	t.Run("custom error handler", func(t *testing.T) {
+		var handled error
+		middleware := Middleware{
+			Ratelimiter: &failingLimiter{err: errors.New("backend down")},
+			OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+				handled = err
+				w.WriteHeader(http.StatusOK)
+			},
+		}
+
+		rec := httptest.NewRecorder()
+		middleware.RateLimitMiddleware(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/test", nil))
+
+		if handled == nil || rec.Code != http.StatusOK {
+			t.Errorf("expected the error handler to fail open got %d %v", rec.Code, handled)
+		}
+	})
+
+	t.Run("transport returns limiter errors", func(t *testing.T) {
+		transport := &Transport{Ratelimiter: &failingLimiter{err: errors.New("backend down")}}
+
+		_, err := transport.RoundTrip(httptest.NewRequest("GET", "http://example.com/", nil))
+		if err == nil || err.Error() != "backend down" {
+			t.Errorf("expected the limiter error got %v", err)
+		}
+	})
+}
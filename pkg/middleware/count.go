@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+)
+
+// Refunder is implemented by *ratelimiter.Ratelimiter.
+type Refunder interface {
+	Refund(identifier string, n int) error
+	// CanRefund reports whether Refund takes effect, it is checked once when
+	// the middleware is built.
+	CanRefund() bool
+}
+
+// CountFailures only counts 4xx and 5xx responses, for example to limit
+// failed logins without limiting successful ones.
+func CountFailures(status int) bool {
+	return status >= 400
+}
+
+// RefundServerErrors counts everything except 5xx responses, so clients do
+// not pay for the server's own failures.
+func RefundServerErrors(status int) bool {
+	return status < 500
+}
+
+// CountStatusClasses counts responses whose status class is listed, 2 for
+// 2xx and so on.
+func CountStatusClasses(classes ...int) func(status int) bool {
+	return func(status int) bool {
+		for _, class := range classes {
+			if status/100 == class {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// refunder returns the limiter Counts refunds through. It panics if Counts is
+// set and the limiter cannot refund, since every request would count.
+func (m *Middleware) refunder() Refunder {
+	if m.Counts == nil {
+		return nil
+	}
+	refunder, ok := m.Ratelimiter.(Refunder)
+	if !ok || !refunder.CanRefund() {
+		panic(fmt.Sprintf("middleware: Counts needs a limiter that supports refunds, %T does not", m.Ratelimiter))
+	}
+	return refunder
+}
+
+// serve runs next and refunds the request if Counts says its response does
+// not count. Access list and shadowed decisions never consumed anything.
+// The remaining limit is only written once the handler chose its status.
+func (m *Middleware) serve(next http.HandlerFunc, refunder Refunder, w http.ResponseWriter, r *http.Request, identifier string, class string, decision ratelimiter.Decision) {
+	if refunder == nil || decision.Source != ratelimiter.SourceStrategy || decision.Shadowed {
+		writeRemaining(w, decision)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, prefix: remainingLine(decision)}
+	next.ServeHTTP(recorder, r)
+	if recorder.status == 0 {
+		recorder.WriteHeader(http.StatusOK)
+	}
+	if m.Counts(recorder.status) {
+		return
+	}
+	// Refunds only fail for networked limiters, the request then counts.
+	if priority, ok := m.priority(); ok {
+		priority.RefundPriority(identifier, class, 1)
+		return
+	}
+	refunder.Refund(identifier, 1)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// prefix is written right after the status.
+	prefix []byte
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status != 0 || status < http.StatusOK {
+		s.ResponseWriter.WriteHeader(status)
+		return
+	}
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+	if len(s.prefix) > 0 {
+		s.ResponseWriter.Write(s.prefix)
+	}
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.WriteHeader(http.StatusOK)
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
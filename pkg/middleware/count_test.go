@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func TestMiddlewareCounts(t *testing.T) {
+	// The handler answers with the status in the query, e.g. /login?status=401.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}
+
+	newMiddleware := func(counts func(status int) bool) (http.HandlerFunc, func()) {
+		rl := ratelimiter.NewRateLimiter(2, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		middleware := Middleware{Ratelimiter: rl, Counts: counts}
+		return middleware.RateLimitMiddleware(handler), rl.Stop
+	}
+
+	serve := func(next http.HandlerFunc, status int) int {
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, httptest.NewRequest("POST", "/login?status="+strconv.Itoa(status), nil))
+		return rec.Code
+	}
+
+	t.Run("count failures", func(t *testing.T) {
+		next, stop := newMiddleware(CountFailures)
+		defer stop()
+
+		for range 5 {
+			if code := serve(next, http.StatusOK); code != http.StatusOK {
+				t.Fatalf("expected successful logins not to count, got %d", code)
+			}
+		}
+		serve(next, http.StatusUnauthorized)
+		serve(next, http.StatusUnauthorized)
+		if code := serve(next, http.StatusOK); code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 after two failed logins, got %d", code)
+		}
+	})
+
+	t.Run("refund server errors", func(t *testing.T) {
+		next, stop := newMiddleware(RefundServerErrors)
+		defer stop()
+
+		for range 5 {
+			serve(next, http.StatusBadGateway)
+		}
+		serve(next, http.StatusOK)
+		serve(next, http.StatusNotFound)
+		if code := serve(next, http.StatusOK); code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 once two non 5xx responses counted, got %d", code)
+		}
+	})
+
+	t.Run("count by status class", func(t *testing.T) {
+		next, stop := newMiddleware(CountStatusClasses(2))
+		defer stop()
+
+		for range 5 {
+			serve(next, http.StatusNotModified)
+		}
+		serve(next, http.StatusOK)
+		serve(next, http.StatusCreated)
+		if code := serve(next, http.StatusOK); code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 once two 2xx responses counted, got %d", code)
+		}
+	})
+
+	t.Run("handlers that only write count as 200", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		middleware := Middleware{Ratelimiter: rl, Counts: CountFailures}
+		next := middleware.RateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+
+		for range 3 {
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d", rec.Code)
+			}
+		}
+	})
+
+	t.Run("the handler's status reaches the client", func(t *testing.T) {
+		next, stop := newMiddleware(CountFailures)
+		defer stop()
+
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, httptest.NewRequest("POST", "/login?status=401", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rec.Code)
+		}
+		if rec.Body.String() != "Remaining limit = 1\n" {
+			t.Errorf("expected the remaining limit after the status, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("limiters that cannot refund are rejected", func(t *testing.T) {
+		// Embedding the interface hides the strategy's Refund method.
+		strategy := struct{ ratelimiter.RateLimitStrategy }{strategies.NewFixedWindowStrategy(2, time.Minute, &strategies.RealTimeProvider{})}
+		rl := ratelimiter.NewRateLimiterWithStrategy(strategy)
+		defer rl.Stop()
+
+		defer func() {
+			if recover() == nil {
+				t.Error("expected building the middleware to panic")
+			}
+		}()
+		middleware := Middleware{Ratelimiter: rl, Counts: CountFailures}
+		middleware.RateLimitMiddleware(handler)
+	})
+}
@@ -1,35 +1,151 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
 )
 
 type Limiter interface {
 	IsRequestAllowed(identifier string) (bool, int)
+	// Allow fails if the limiter cannot decide, for example because its
+	// backend is unreachable or ctx is done.
+	Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error)
 	Stop()
 }
 
 type Middleware struct {
 	Ratelimiter Limiter
+	AccessList  *accesslist.List
+
+	// KeyFunc names the identifier a request is limited and matched against
+	// the access list under. Defaults to the client's IP address. Returning
+	// the same key for every request shares one limit between all clients,
+	// for example to reserve priority shares of a global limit.
+	KeyFunc func(r *http.Request) string
+
+	// Shadow lets every request through and reports would-be rejections,
+	// including the ones shadowed by the limiter itself, to OnShadow.
+	Shadow   bool
+	OnShadow func(r *http.Request, decision ratelimiter.Decision)
+
+	// OnReject writes the response for rejected requests. Defaults to a
+	// plain text 429, or 403 for deny-listed clients.
+	OnReject RejectionHandler
+
+	// OnError writes the response when the limiter fails. Defaults to a
+	// plain text 503.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+
+	// Classify names the priority class of a request. It is used when the
+	// limiter implements ratelimiter.PriorityLimiter, such as a Ratelimiter
+	// configured with Priorities.
+	Classify func(r *http.Request) string
+
+	// Counts decides after the handler ran whether the response counts
+	// against the limit, see CountFailures, RefundServerErrors and
+	// CountStatusClasses. Requests it does not count are refunded, which
+	// needs a limiter implementing Refunder whose strategy supports refunds,
+	// RateLimitMiddleware panics otherwise. Nil counts every request.
+	Counts func(status int) bool
 }
 
 func (m *Middleware) RateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	refunder := m.refunder()
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		identifier := m.key(r)
+		class := m.classify(r)
+
+		decision, err := m.decide(r, identifier, class)
 		if err != nil {
-			panic("Error while spliting the identifier address")
+			m.errorHandler()(w, r, err)
+			return
+		}
+		if m.Shadow && !decision.Allowed {
+			decision.Allowed = true
+			decision.Shadowed = true
+		}
+		if decision.Shadowed && m.OnShadow != nil {
+			m.OnShadow(r, decision)
 		}
-		identifier := host
 
-		if allowed, remainingLimit := m.Ratelimiter.IsRequestAllowed(identifier); allowed {
-			w.Write([]byte(fmt.Sprintf("Remaining limit = %d\n", remainingLimit)))
-			next.ServeHTTP(w, r)
+		if decision.Allowed {
+			m.serve(next, refunder, w, r, identifier, class, decision)
 		} else {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			m.rejectionHandler().Reject(w, r, decision)
 		}
 	})
 }
+
+func writeRemaining(w http.ResponseWriter, decision ratelimiter.Decision) {
+	if line := remainingLine(decision); line != nil {
+		w.Write(line)
+	}
+}
+
+func remainingLine(decision ratelimiter.Decision) []byte {
+	if decision.Source != ratelimiter.SourceStrategy {
+		return nil
+	}
+	return []byte(fmt.Sprintf("Remaining limit = %d\n", decision.Remaining))
+}
+
+func (m *Middleware) decide(r *http.Request, identifier string, class string) (ratelimiter.Decision, error) {
+	if decision, listed := ratelimiter.CheckAccessList(m.AccessList, identifier); listed {
+		return decision, nil
+	}
+	if priority, ok := m.priority(); ok {
+		return priority.AllowPriority(r.Context(), identifier, class)
+	}
+	return m.Ratelimiter.Allow(r.Context(), identifier)
+}
+
+// priority returns the limiter if requests are decided by priority class.
+func (m *Middleware) priority() (ratelimiter.PriorityLimiter, bool) {
+	priority, ok := m.Ratelimiter.(ratelimiter.PriorityLimiter)
+	return priority, ok && m.Classify != nil
+}
+
+func (m *Middleware) classify(r *http.Request) string {
+	if _, ok := m.priority(); !ok {
+		return ""
+	}
+	return m.Classify(r)
+}
+
+func (m *Middleware) key(r *http.Request) string {
+	if m.KeyFunc != nil {
+		return m.KeyFunc(r)
+	}
+	return clientIP(r)
+}
+
+func (m *Middleware) errorHandler() func(w http.ResponseWriter, r *http.Request, err error) {
+	if m.OnError != nil {
+		return m.OnError
+	}
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, "Rate limiter unavailable", http.StatusServiceUnavailable)
+	}
+}
+
+func (m *Middleware) rejectionHandler() RejectionHandler {
+	if m.OnReject != nil {
+		return m.OnReject
+	}
+	return PlainTextRejection(0)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		panic("Error while spliting the identifier address")
+	}
+	return host
+}
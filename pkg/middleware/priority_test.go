@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func TestMiddlewarePriority(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	rl := ratelimiter.NewRatelimiterWithConfig(&ratelimiter.Config{
+		Strategy:     "fixed_window",
+		Limit:        4,
+		WindowSize:   time.Minute,
+		TimeProvider: &strategies.RealTimeProvider{},
+		Priorities:   []ratelimiter.PriorityClass{{Name: "health", Share: 0.5}, {Name: "batch"}},
+	})
+	defer rl.Stop()
+
+	middleware := Middleware{
+		Ratelimiter: rl,
+		Classify: func(r *http.Request) string {
+			if r.URL.Path == "/healthz" {
+				return "health"
+			}
+			return "batch"
+		},
+	}
+	next := middleware.RateLimitMiddleware(handler)
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code
+	}
+
+	for i := range 4 {
+		expected := http.StatusOK
+		if i >= 2 {
+			expected = http.StatusTooManyRequests
+		}
+		if code := serve("/batch"); code != expected {
+			t.Errorf("batch request %d: expected %d, got %d", i, expected, code)
+		}
+	}
+
+	for range 2 {
+		if code := serve("/healthz"); code != http.StatusOK {
+			t.Errorf("expected health checks to use their reservation, got %d", code)
+		}
+	}
+}
+
+func TestMiddlewarePriorityRefunds(t *testing.T) {
+	rl := ratelimiter.NewRatelimiterWithConfig(&ratelimiter.Config{
+		Strategy:     "fixed_window",
+		Limit:        4,
+		WindowSize:   time.Minute,
+		TimeProvider: &strategies.RealTimeProvider{},
+		Priorities:   []ratelimiter.PriorityClass{{Name: "health", Share: 0.5}, {Name: "batch"}},
+	})
+	defer rl.Stop()
+
+	middleware := Middleware{
+		Ratelimiter: rl,
+		Classify: func(r *http.Request) string {
+			if r.URL.Path == "/healthz" {
+				return "health"
+			}
+			return "batch"
+		},
+		Counts: CountFailures,
+	}
+	next := middleware.RateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, path := range []string{"/healthz", "/healthz", "/healthz", "/batch", "/batch", "/batch"} {
+		next.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Batch may use everything except health's unused reservation.
+	if decision := rl.Peek("192.0.2.1"); decision.Remaining != 2 {
+		t.Errorf("expected the refunds to restore health's reservation got %d remaining for batch", decision.Remaining)
+	}
+}
+
+func TestMiddlewarePriorityGlobalKey(t *testing.T) {
+	rl := ratelimiter.NewRatelimiterWithConfig(&ratelimiter.Config{
+		Strategy:     "fixed_window",
+		Limit:        10,
+		WindowSize:   time.Minute,
+		TimeProvider: &strategies.RealTimeProvider{},
+		Priorities:   []ratelimiter.PriorityClass{{Name: "health", Share: 0.2}, {Name: "paid", Share: 0.4}, {Name: "batch"}},
+	})
+	defer rl.Stop()
+
+	middleware := Middleware{
+		Ratelimiter: rl,
+		Classify:    func(r *http.Request) string { return r.URL.Query().Get("class") },
+		KeyFunc:     func(r *http.Request) string { return "global" },
+	}
+	next := middleware.RateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Every request comes from a different client.
+	client := 0
+	serve := func(class string) int {
+		client++
+		req := httptest.NewRequest("GET", "/?class="+class, nil)
+		req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", client)
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	allowed := func(class string, n int) int {
+		count := 0
+		for range n {
+			if serve(class) == http.StatusOK {
+				count++
+			}
+		}
+		return count
+	}
+
+	if got := allowed("batch", 10); got != 4 {
+		t.Errorf("expected batch traffic of all clients to be shed after 4 got %d", got)
+	}
+	if got := allowed("paid", 10); got != 4 {
+		t.Errorf("expected paid traffic to keep its 4 got %d", got)
+	}
+	if got := allowed("health", 10); got != 2 {
+		t.Errorf("expected health checks to keep their 2 got %d", got)
+	}
+}
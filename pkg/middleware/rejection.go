@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"encoding/json"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+)
+
+// RejectionHandler writes the response for a request the limiter rejected.
+type RejectionHandler interface {
+	Reject(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision)
+}
+
+type RejectionHandlerFunc func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision)
+
+func (f RejectionHandlerFunc) Reject(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+	f(w, r, decision)
+}
+
+// The built-in handlers answer with status, or with 403 for deny-listed
+// clients and 429 for everything else when status is 0. They set Retry-After
+// when the decision says when the client is allowed again.
+
+func PlainTextRejection(status int) RejectionHandler {
+	return RejectionHandlerFunc(func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+		code := rejectionStatus(status, decision)
+		setRetryAfter(w, decision)
+		http.Error(w, http.StatusText(code), code)
+	})
+}
+
+type problemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance,omitempty"`
+	Source    string `json:"source"`
+	Remaining int    `json:"remaining"`
+}
+
+// ProblemJSONRejection answers with an RFC 9457 application/problem+json body.
+func ProblemJSONRejection(status int) RejectionHandler {
+	return RejectionHandlerFunc(func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+		code := rejectionStatus(status, decision)
+		setRetryAfter(w, decision)
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(problemDetails{
+			Type:      "about:blank",
+			Title:     http.StatusText(code),
+			Status:    code,
+			Detail:    rejectionDetail(decision),
+			Instance:  r.URL.Path,
+			Source:    decision.Source.String(),
+			Remaining: decision.Remaining,
+		})
+	})
+}
+
+var rejectionPage = template.Must(template.New("rejection").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Detail}}</p>
+</body>
+</html>
+`))
+
+func HTMLRejection(status int) RejectionHandler {
+	return RejectionHandlerFunc(func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+		code := rejectionStatus(status, decision)
+		setRetryAfter(w, decision)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		rejectionPage.Execute(w, struct{ Title, Detail string }{http.StatusText(code), rejectionDetail(decision)})
+	})
+}
+
+// RedirectRejection sends rejected clients to url, with http.StatusSeeOther
+// when status is 0.
+func RedirectRejection(url string, status int) RejectionHandler {
+	if status == 0 {
+		status = http.StatusSeeOther
+	}
+	return RejectionHandlerFunc(func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+		http.Redirect(w, r, url, status)
+	})
+}
+
+func rejectionStatus(status int, decision ratelimiter.Decision) int {
+	if status != 0 {
+		return status
+	}
+	if decision.Source == ratelimiter.SourceDenyList {
+		return http.StatusForbidden
+	}
+	return http.StatusTooManyRequests
+}
+
+// setRetryAfter rounds the wait up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, decision ratelimiter.Decision) {
+	if wait := time.Until(decision.RetryAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+}
+
+func rejectionDetail(decision ratelimiter.Decision) string {
+	switch decision.Source {
+	case ratelimiter.SourceDenyList:
+		return "Access from this client is not allowed."
+	case ratelimiter.SourcePenaltyBox:
+		return "This client is temporarily banned after repeatedly exceeding the rate limit."
+	default:
+		return "The rate limit for this client has been exceeded, try again later."
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func rejectSecondRequest(t *testing.T, onReject RejectionHandler) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+	t.Cleanup(rl.Stop)
+	middleware := Middleware{Ratelimiter: rl, OnReject: onReject}
+
+	next := middleware.RateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	next.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+
+	rec := httptest.NewRecorder()
+	next.ServeHTTP(rec, httptest.NewRequest("GET", "/api/items", nil))
+	return rec
+}
+
+func TestRejectionHandlers(t *testing.T) {
+	t.Run("default is plain text 429", func(t *testing.T) {
+		rec := rejectSecondRequest(t, nil)
+
+		if rec.Code != http.StatusTooManyRequests || rec.Body.String() != "Too Many Requests\n" {
+			t.Errorf("expected plain text 429 got %d %q", rec.Code, rec.Body.String())
+		}
+		if retryAfter := rec.Header().Get("Retry-After"); retryAfter == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+
+	t.Run("problem details", func(t *testing.T) {
+		rec := rejectSecondRequest(t, ProblemJSONRejection(0))
+
+		if rec.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("expected problem+json content type got %q", rec.Header().Get("Content-Type"))
+		}
+
+		var problem map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("body is not valid json: %v", err)
+		}
+		if problem["status"] != float64(429) || problem["title"] != "Too Many Requests" || problem["instance"] != "/api/items" {
+			t.Errorf("unexpected problem details %v", problem)
+		}
+	})
+
+	t.Run("html with a custom status", func(t *testing.T) {
+		rec := rejectSecondRequest(t, HTMLRejection(http.StatusServiceUnavailable))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "<h1>Service Unavailable</h1>") {
+			t.Errorf("expected html page got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		rec := rejectSecondRequest(t, RedirectRejection("/slow-down", 0))
+
+		if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/slow-down" {
+			t.Errorf("expected redirect to /slow-down got %d %q", rec.Code, rec.Header().Get("Location"))
+		}
+	})
+
+	t.Run("custom handler receives the decision", func(t *testing.T) {
+		var got ratelimiter.Decision
+		rejectSecondRequest(t, RejectionHandlerFunc(func(w http.ResponseWriter, r *http.Request, decision ratelimiter.Decision) {
+			got = decision
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+
+		if got.Allowed || got.Source != ratelimiter.SourceStrategy {
+			t.Errorf("expected a strategy rejection got %+v", got)
+		}
+		if !got.RetryAt.After(time.Now()) {
+			t.Errorf("expected the decision to say when to retry got %v", got.RetryAt)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+func TestMiddlewareShadow(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	t.Run("shadow middleware never rejects", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		shadowed := 0
+		middleware := Middleware{
+			Ratelimiter: rl,
+			Shadow:      true,
+			OnShadow: func(r *http.Request, decision ratelimiter.Decision) {
+				shadowed++
+			},
+		}
+
+		next := middleware.RateLimitMiddleware(handler)
+
+		for range 3 {
+			req := httptest.NewRequest("GET", "/test", nil)
+			rec := httptest.NewRecorder()
+			next.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("Expected 200, got %d", rec.Code)
+			}
+		}
+
+		if shadowed != 2 {
+			t.Errorf("expected 2 shadowed rejections got %d", shadowed)
+		}
+	})
+
+	t.Run("reports rejections shadowed by the limiter", func(t *testing.T) {
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		rl.SetShadow(true, nil)
+
+		shadowed := 0
+		middleware := Middleware{
+			Ratelimiter: rl,
+			OnShadow: func(r *http.Request, decision ratelimiter.Decision) {
+				shadowed++
+			},
+		}
+
+		next := middleware.RateLimitMiddleware(handler)
+
+		for range 2 {
+			req := httptest.NewRequest("GET", "/test", nil)
+			next.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		if shadowed != 1 {
+			t.Errorf("expected 1 shadowed rejection got %d", shadowed)
+		}
+	})
+}
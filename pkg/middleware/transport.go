@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+const defaultWaitInterval = 50 * time.Millisecond
+
+type RateLimitedError struct {
+	Key string
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("outbound rate limit exceeded for %s", e.Key)
+}
+
+// Transport throttles outgoing requests. Requests are keyed by destination
+// host unless KeyFunc is set. When Wait is false a throttled request fails
+// with a *RateLimitedError, otherwise it waits until the decision's RetryAt
+// and tries again, until it is allowed or its context is done. Decisions
+// without a RetryAt are retried every WaitInterval instead. Keys rejected by
+// an access list or a penalty box are never waited for.
+type Transport struct {
+	Ratelimiter  Limiter
+	Base         http.RoundTripper
+	KeyFunc      func(r *http.Request) string
+	Wait         bool
+	WaitInterval time.Duration
+	// Clock times the waits, real time if nil.
+	Clock clock.Clock
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := t.key(r)
+
+	for {
+		decision, err := t.Ratelimiter.Allow(r.Context(), key)
+		if err != nil {
+			closeBody(r)
+			return nil, err
+		}
+		if decision.Allowed {
+			return t.base().RoundTrip(r)
+		}
+
+		if !t.Wait || decision.Source != ratelimiter.SourceStrategy {
+			closeBody(r)
+			return nil, &RateLimitedError{Key: key}
+		}
+
+		timer := t.clock().NewTimer(t.wait(decision))
+		select {
+		case <-timer.C():
+		case <-r.Context().Done():
+			timer.Stop()
+			closeBody(r)
+			return nil, r.Context().Err()
+		}
+	}
+}
+
+func (t *Transport) key(r *http.Request) string {
+	if t.KeyFunc != nil {
+		return t.KeyFunc(r)
+	}
+	return r.URL.Host
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) clock() clock.Clock {
+	if t.Clock != nil {
+		return t.Clock
+	}
+	return clock.Real{}
+}
+
+// wait returns how long a throttled request sleeps before it tries again.
+func (t *Transport) wait(decision ratelimiter.Decision) time.Duration {
+	if wait := decision.RetryAt.Sub(t.clock().Now()); wait > 0 {
+		return wait
+	}
+	if t.WaitInterval > 0 {
+		return t.WaitInterval
+	}
+	return defaultWaitInterval
+}
+
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
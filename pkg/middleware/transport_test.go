@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func newUpstream(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport(t *testing.T) {
+	t.Run("fails fast with a typed error", func(t *testing.T) {
+		server := newUpstream(t)
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		client := &http.Client{Transport: &Transport{Ratelimiter: rl}}
+
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("first request should be allowed got %v", err)
+		}
+		res.Body.Close()
+
+		_, err = client.Get(server.URL)
+
+		var rateLimited *RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			t.Fatalf("expected RateLimitedError got %v", err)
+		}
+		if rateLimited.Key != server.Listener.Addr().String() {
+			t.Errorf("expected key to be the destination host got %s", rateLimited.Key)
+		}
+	})
+
+	t.Run("uses a custom key", func(t *testing.T) {
+		server := newUpstream(t)
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		keys := []string{"tenant-a", "tenant-b"}
+		i := 0
+		client := &http.Client{Transport: &Transport{
+			Ratelimiter: rl,
+			KeyFunc: func(r *http.Request) string {
+				key := keys[i%len(keys)]
+				i++
+				return key
+			},
+		}}
+
+		for range 2 {
+			res, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("requests with different keys should be allowed got %v", err)
+			}
+			res.Body.Close()
+		}
+	})
+
+	t.Run("waits until the limit opens up", func(t *testing.T) {
+		server := newUpstream(t)
+		rl := ratelimiter.NewRateLimiter(1, 100*time.Millisecond, &strategies.RealTimeProvider{}, "token_bucket")
+		defer rl.Stop()
+
+		client := &http.Client{Transport: &Transport{Ratelimiter: rl, Wait: true, WaitInterval: 10 * time.Millisecond}}
+
+		for range 2 {
+			res, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("request should eventually be allowed got %v", err)
+			}
+			res.Body.Close()
+		}
+	})
+
+	t.Run("waiting respects the request context", func(t *testing.T) {
+		server := newUpstream(t)
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+
+		client := &http.Client{Transport: &Transport{Ratelimiter: rl, Wait: true, WaitInterval: 10 * time.Millisecond}}
+
+		res, _ := client.Get(server.URL)
+		res.Body.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+
+		_, err := client.Do(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected deadline exceeded got %v", err)
+		}
+	})
+
+	t.Run("waits until the limit resets instead of polling", func(t *testing.T) {
+		server := newUpstream(t)
+		fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		rl := &countingLimiter{Ratelimiter: ratelimiter.NewRateLimiter(1, time.Minute, fakeClock, "fixed_window")}
+		defer rl.Stop()
+
+		client := &http.Client{Transport: &Transport{Ratelimiter: rl, Wait: true, WaitInterval: time.Second, Clock: fakeClock}}
+		res, _ := client.Get(server.URL)
+		res.Body.Close()
+
+		done := make(chan error)
+		go func() {
+			res, err := client.Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+			done <- err
+		}()
+
+		// The cleanup ticker and the wait timer.
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(59 * time.Second)
+		fakeClock.Advance(time.Second)
+		if err := <-done; err != nil {
+			t.Fatalf("request should be allowed after the reset got %v", err)
+		}
+		if rl.calls != 3 {
+			t.Errorf("expected the limiter to be asked 3 times got %d", rl.calls)
+		}
+	})
+
+	t.Run("waits for the next token instead of a full bucket", func(t *testing.T) {
+		server := newUpstream(t)
+		fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		rl := ratelimiter.NewRateLimiter(10, time.Minute, fakeClock, "token_bucket")
+		defer rl.Stop()
+
+		client := &http.Client{Transport: &Transport{Ratelimiter: rl, Wait: true, WaitInterval: time.Minute, Clock: fakeClock}}
+		for range 10 {
+			res, _ := client.Get(server.URL)
+			res.Body.Close()
+		}
+
+		done := make(chan error)
+		go func() {
+			res, err := client.Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+			done <- err
+		}()
+
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(6 * time.Second)
+		if err := <-done; err != nil {
+			t.Fatalf("request should be allowed once the next token is due got %v", err)
+		}
+	})
+
+	t.Run("deny-listed keys are not waited for", func(t *testing.T) {
+		server := newUpstream(t)
+		rl := ratelimiter.NewRateLimiter(1, time.Minute, &strategies.RealTimeProvider{}, "fixed_window")
+		defer rl.Stop()
+		list, _ := accesslist.New(nil, []string{"blocked"})
+		rl.SetAccessList(list)
+
+		client := &http.Client{Transport: &Transport{
+			Ratelimiter: rl,
+			Wait:        true,
+			KeyFunc:     func(r *http.Request) string { return "blocked" },
+		}}
+
+		_, err := client.Get(server.URL)
+		var rateLimited *RateLimitedError
+		if !errors.As(err, &rateLimited) {
+			t.Errorf("expected RateLimitedError got %v", err)
+		}
+	})
+}
+
+// countingLimiter counts how often the transport asks for a decision.
+type countingLimiter struct {
+	*ratelimiter.Ratelimiter
+	calls int
+}
+
+func (c *countingLimiter) Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error) {
+	c.calls++
+	return c.Ratelimiter.Allow(ctx, identifier)
+}
@@ -0,0 +1,157 @@
+package ratelimit_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+	"github.com/egedolmaci/my-ratelimiter/pkg/middleware"
+	"github.com/egedolmaci/my-ratelimiter/pkg/ratelimit"
+)
+
+func Example() {
+	limiter, err := ratelimit.New(ratelimit.SlidingWindowLog, 2, time.Minute)
+	if err != nil {
+		panic(err)
+	}
+	defer limiter.Stop()
+
+	for range 3 {
+		decision := limiter.Decide("203.0.113.7")
+		fmt.Println(decision.Allowed, decision.Remaining)
+	}
+	// Output:
+	// true 1
+	// true 0
+	// false 0
+}
+
+func ExampleWithTimeProvider() {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter, _ := ratelimit.New(ratelimit.FixedWindow, 1, time.Minute, ratelimit.WithTimeProvider(fakeClock))
+	defer limiter.Stop()
+
+	fmt.Println(limiter.Decide("ege").Allowed)
+	fmt.Println(limiter.Decide("ege").Allowed)
+
+	fakeClock.Advance(time.Minute)
+	fmt.Println(limiter.Decide("ege").Allowed)
+	// Output:
+	// true
+	// false
+	// true
+}
+
+func ExampleWithLimitProvider() {
+	plans := map[string]ratelimit.Limits{"enterprise-customer": {Limit: 1000}}
+	limiter, _ := ratelimit.New(ratelimit.TokenBucket, 10, time.Minute,
+		ratelimit.WithLimitProvider(ratelimit.LimitProviderFunc(func(identifier string) ratelimit.Limits {
+			return plans[identifier]
+		})))
+	defer limiter.Stop()
+
+	fmt.Println(limiter.Decide("free-customer").Remaining)
+	fmt.Println(limiter.Decide("enterprise-customer").Remaining)
+	// Output:
+	// 9
+	// 999
+}
+
+type allowAll struct{}
+
+func (allowAll) IsRequestAllowed(identifier string) (bool, int) { return true, ratelimit.Unlimited }
+func (allowAll) Peek(identifier string) (bool, int)             { return true, ratelimit.Unlimited }
+func (allowAll) Reset(identifier string)                        {}
+func (allowAll) Grant(identifier string, n int)                 {}
+func (allowAll) Stop()                                          {}
+
+func ExampleNewWithStrategy() {
+	limiter := ratelimit.NewWithStrategy(allowAll{})
+	defer limiter.Stop()
+
+	fmt.Println(limiter.Decide("anyone").Allowed)
+	// Output: true
+}
+
+func ExampleRegisterStrategy() {
+	ratelimit.RegisterStrategy(ratelimit.StrategyDefinition{
+		Name: "allow_all",
+		New: func(params ratelimit.Params, timeProvider ratelimit.TimeProvider) (ratelimit.Strategy, error) {
+			return allowAll{}, nil
+		},
+	})
+
+	limiter, err := ratelimit.NewFromConfig(ratelimit.Config{Strategy: "allow_all"})
+	if err != nil {
+		panic(err)
+	}
+	defer limiter.Stop()
+
+	fmt.Println(limiter.Decide("anyone").Allowed)
+	// Output: true
+}
+
+func ExampleRatelimiter_Allow() {
+	limiter, _ := ratelimit.New(ratelimit.FixedWindow, 10, time.Minute)
+	defer limiter.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	decision, err := limiter.Allow(ctx, "ege")
+	if err != nil {
+		// The limiter could not decide, fail open or closed here.
+		return
+	}
+	fmt.Println(decision.Allowed, decision.Remaining)
+	// Output: true 9
+}
+
+func ExampleNewBandwidthLimiter() {
+	download := ratelimit.NewBandwidthLimiter(64*1024, &ratelimit.RealTime{})
+	defer download.Stop()
+
+	throttle := &middleware.BandwidthMiddleware{Download: download}
+	http.Handle("/files/", throttle.ThrottleMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, r.URL.Path[1:])
+	}))
+}
+
+func ExampleNewAccessList() {
+	list, err := ratelimit.NewAccessList([]string{"10.0.0.0/8"}, []string{"203.0.113.7"})
+	if err != nil {
+		panic(err)
+	}
+	limiter, _ := ratelimit.New(ratelimit.FixedWindow, 10, time.Minute)
+	defer limiter.Stop()
+	limiter.SetAccessList(list)
+
+	fmt.Println(limiter.Decide("10.1.2.3").Source)
+	fmt.Println(limiter.Decide("203.0.113.7").Allowed)
+	// Output:
+	// allow_list
+	// false
+}
+
+func ExampleNewPenaltyBox() {
+	limiter, _ := ratelimit.New(ratelimit.FixedWindow, 1, time.Minute)
+	box := ratelimit.NewPenaltyBox(limiter, ratelimit.PenaltyConfig{
+		Threshold:   2,
+		Window:      time.Minute,
+		BanDuration: time.Hour,
+	}, &ratelimit.RealTime{})
+	defer box.Stop()
+
+	for range 4 {
+		fmt.Println(box.Decide("ege").Source)
+	}
+	fmt.Println(len(box.Bans()))
+	// Output:
+	// strategy
+	// strategy
+	// strategy
+	// penalty_box
+	// 1
+}
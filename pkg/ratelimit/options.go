@@ -0,0 +1,86 @@
+package ratelimit
+
+import "time"
+
+type Option func(*Config)
+
+// WithName names the policy in logs and the admin API.
+func WithName(name string) Option {
+	return func(c *Config) {
+		c.Name = name
+	}
+}
+
+// WithTimeProvider replaces real time, for example with a clock.Fake in
+// tests.
+func WithTimeProvider(timeProvider TimeProvider) Option {
+	return func(c *Config) {
+		c.TimeProvider = timeProvider
+	}
+}
+
+// WithLocation sets the time zone calendar strategies reset in.
+func WithLocation(location *time.Location) Option {
+	return func(c *Config) {
+		c.Location = location
+	}
+}
+
+// WithLocationFor resolves the time zone calendar strategies reset in per
+// identifier, for example from the customer's account. Returning nil falls
+// back to WithLocation.
+func WithLocationFor(locationFor func(identifier string) *time.Location) Option {
+	return func(c *Config) {
+		c.LocationFor = locationFor
+	}
+}
+
+// WithMaxKeys caps how many identifiers are tracked at once.
+func WithMaxKeys(maxKeys int, policy EvictionPolicy) Option {
+	return func(c *Config) {
+		c.MaxKeys = maxKeys
+		c.EvictionPolicy = policy
+	}
+}
+
+// WithSnapshot restores state from path on start and saves it every
+// interval.
+func WithSnapshot(path string, interval time.Duration) Option {
+	return func(c *Config) {
+		c.SnapshotPath = path
+		c.SnapshotInterval = interval
+	}
+}
+
+// WithSnapshotErrors replaces logging of failed periodic snapshots.
+func WithSnapshotErrors(onError func(err error)) Option {
+	return func(c *Config) {
+		c.OnSnapshotError = onError
+	}
+}
+
+// WithShadow lets every request through and reports would-be rejections to
+// observer, which may be nil.
+func WithShadow(observer ShadowObserver) Option {
+	return func(c *Config) {
+		c.Shadow = true
+		c.ShadowObserver = observer
+	}
+}
+
+// WithLimitProvider resolves limit and window per identifier.
+func WithLimitProvider(provider LimitProvider) Option {
+	return func(c *Config) {
+		c.LimitProvider = provider
+	}
+}
+
+// WithPriorities splits the limit between priority classes, listed from the
+// highest priority to the lowest. Decide requests with AllowPriority. Shares
+// are reserved out of each identifier's limit, to reserve them out of a limit
+// shared by all clients give the middleware a KeyFunc returning one key.
+func WithPriorities(classes ...PriorityClass) Option {
+	return func(c *Config) {
+		c.Priorities = classes
+	}
+}
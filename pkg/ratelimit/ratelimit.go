@@ -0,0 +1,213 @@
+// Package ratelimit is the public API of the limiter. It builds limiters from
+// a strategy name and functional options and re-exports the types needed to
+// use them, implement strategies and control time in tests.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/accesslist"
+	"github.com/egedolmaci/my-ratelimiter/internal/bandwidth"
+	"github.com/egedolmaci/my-ratelimiter/internal/cluster"
+	"github.com/egedolmaci/my-ratelimiter/internal/crdt"
+	"github.com/egedolmaci/my-ratelimiter/internal/lease"
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+)
+
+const (
+	FixedWindow          = "fixed_window"
+	SlidingWindowLog     = "sliding_window_log"
+	SlidingWindowCounter = "sliding_window_counter"
+	TokenBucket          = "token_bucket"
+	CalendarDay          = "calendar_day"
+	CalendarWeek         = "calendar_week"
+	CalendarMonth        = "calendar_month"
+	// FairShare splits one global limit between the identifiers, treated as
+	// tenants, by weighted max-min fairness.
+	FairShare = "fair_share"
+)
+
+type (
+	Ratelimiter = ratelimiter.Ratelimiter
+	// Strategy is implemented by custom algorithms passed to NewWithStrategy.
+	Strategy = ratelimiter.RateLimitStrategy
+	// ContextStrategy is implemented by strategies that can block or fail.
+	ContextStrategy = ratelimiter.ContextStrategy
+	Config          = ratelimiter.Config
+
+	Decision       = ratelimiter.Decision
+	DecisionSource = ratelimiter.DecisionSource
+	ShadowObserver = ratelimiter.ShadowObserver
+
+	TimeProvider = strategies.TimeProvider
+	RealTime     = strategies.RealTimeProvider
+
+	Limits            = strategies.Limits
+	LimitProvider     = strategies.LimitProvider
+	LimitProviderFunc = strategies.LimitProviderFunc
+
+	EvictionPolicy = strategies.EvictionPolicy
+	KeyState       = strategies.KeyState
+	QuotaUsage     = strategies.QuotaUsage
+
+	FairShareStrategy = strategies.FairShareStrategy
+
+	// BandwidthLimiter paces the bytes of readers and writers per
+	// identifier, see middleware.BandwidthMiddleware.
+	BandwidthLimiter = bandwidth.Limiter
+
+	// AccessList holds allow and deny rules, see Ratelimiter.SetAccessList
+	// and middleware.Middleware.
+	AccessList = accesslist.List
+
+	// PenaltyBox bans identifiers that keep getting rejected by a limiter.
+	PenaltyBox    = ratelimiter.PenaltyBox
+	PenaltyConfig = ratelimiter.PenaltyConfig
+	Ban           = ratelimiter.Ban
+
+	StrategyDefinition   = ratelimiter.StrategyDefinition
+	StrategyFactory      = ratelimiter.StrategyFactory
+	Param                = ratelimiter.Param
+	ParamType            = ratelimiter.ParamType
+	Params               = ratelimiter.Params
+	UnknownStrategyError = ratelimiter.UnknownStrategyError
+
+	ResilientStrategy = ratelimiter.ResilientStrategy
+	ResilienceConfig  = ratelimiter.ResilienceConfig
+	ResilienceStats   = ratelimiter.ResilienceStats
+	FailurePolicy     = ratelimiter.FailurePolicy
+	CircuitState      = ratelimiter.CircuitState
+
+	PriorityClass    = ratelimiter.PriorityClass
+	PriorityStrategy = ratelimiter.PriorityStrategy
+	PriorityLimiter  = ratelimiter.PriorityLimiter
+
+	// RefundableStrategy is implemented by strategies that can give back
+	// consumed requests, see Ratelimiter.Refund.
+	RefundableStrategy = ratelimiter.RefundableStrategy
+	RefundChecker      = ratelimiter.RefundChecker
+
+	// LeaseStore is the central quota LeasingStrategy nodes take batches from.
+	LeaseStore      = lease.Store
+	LeaseGrant      = lease.Grant
+	LeaseConfig     = lease.Config
+	LeasingStrategy = lease.Strategy
+
+	// ClusterNode owns part of the keys of a peer-to-peer cluster and
+	// forwards the rest to their owners. Mount its Handler under
+	// ClusterPathPrefix.
+	ClusterNode   = cluster.Node
+	ClusterConfig = cluster.Config
+
+	// GossipStrategy enforces an approximate global limit from replicated
+	// counters without waiting for the network.
+	GossipStrategy      = crdt.Strategy
+	GossipConfig        = crdt.Config
+	GossipDelta         = crdt.Delta
+	GossipTransport     = crdt.Transport
+	GossipHTTPTransport = crdt.HTTPTransport
+)
+
+const (
+	SourceStrategy   = ratelimiter.SourceStrategy
+	SourceAllowList  = ratelimiter.SourceAllowList
+	SourceDenyList   = ratelimiter.SourceDenyList
+	SourcePenaltyBox = ratelimiter.SourcePenaltyBox
+
+	// Unlimited is reported as Remaining for identifiers that are not limited.
+	Unlimited = ratelimiter.Unlimited
+
+	EvictLeastRecentlyUsed = strategies.EvictLeastRecentlyUsed
+	DenyNewKeys            = strategies.DenyNewKeys
+
+	ParamInt      = ratelimiter.ParamInt
+	ParamFloat    = ratelimiter.ParamFloat
+	ParamDuration = ratelimiter.ParamDuration
+	ParamString   = ratelimiter.ParamString
+	ParamBool     = ratelimiter.ParamBool
+
+	FailClosed      = ratelimiter.FailClosed
+	FailOpen        = ratelimiter.FailOpen
+	CircuitClosed   = ratelimiter.CircuitClosed
+	CircuitOpen     = ratelimiter.CircuitOpen
+	CircuitHalfOpen = ratelimiter.CircuitHalfOpen
+
+	ClusterPathPrefix = cluster.PathPrefix
+)
+
+var (
+	NewCachedLimitProvider = strategies.NewCachedLimitProvider
+	NewBandwidthLimiter    = bandwidth.NewLimiter
+	ShadowLogger           = ratelimiter.ShadowLogger
+
+	// NewAccessList takes exact identifiers, IP addresses, CIDR ranges and
+	// path.Match patterns.
+	NewAccessList = accesslist.New
+
+	NewPenaltyBox = ratelimiter.NewPenaltyBox
+
+	// RegisterStrategy makes a custom strategy available to New, Config and
+	// config files by name.
+	RegisterStrategy     = ratelimiter.RegisterStrategy
+	RegisteredStrategies = ratelimiter.RegisteredStrategies
+
+	// Adapt lets an in-memory Strategy satisfy ContextStrategy.
+	Adapt = ratelimiter.Adapt
+
+	NewResilientStrategy = ratelimiter.NewResilientStrategy
+	NewLocalFallback     = ratelimiter.NewLocalFallback
+
+	NewPriorityStrategy = ratelimiter.NewPriorityStrategy
+
+	// ErrRefundUnsupported is returned by Ratelimiter.Refund for strategies
+	// that cannot give requests back.
+	ErrRefundUnsupported = ratelimiter.ErrRefundUnsupported
+
+	NewLeasingStrategy  = lease.NewStrategy
+	NewMemoryLeaseStore = lease.NewMemoryStore
+
+	NewClusterNode = cluster.NewNode
+
+	NewGossipStrategy = crdt.NewStrategy
+)
+
+// LoadConfigFile reads policies from a JSON file. Custom strategies must be
+// registered first.
+func LoadConfigFile(path string) ([]Config, error) {
+	configs, err := ratelimiter.LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]Config, len(configs))
+	for i, config := range configs {
+		values[i] = *config
+	}
+	return values, nil
+}
+
+// New builds a limiter that allows limit requests per window with a
+// registered strategy. Calendar strategies ignore window.
+func New(strategy string, limit int, window time.Duration, opts ...Option) (*Ratelimiter, error) {
+	config := Config{Strategy: strategy, Limit: limit, WindowSize: window}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return NewFromConfig(config)
+}
+
+// NewFromConfig builds any registered strategy, including custom ones.
+func NewFromConfig(config Config) (*Ratelimiter, error) {
+	limiter, err := ratelimiter.NewFromConfig(&config)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: %w", err)
+	}
+	return limiter, nil
+}
+
+// NewWithStrategy wraps a custom strategy. The limiter stops it on Stop.
+func NewWithStrategy(strategy Strategy) *Ratelimiter {
+	return ratelimiter.NewRateLimiterWithStrategy(strategy)
+}
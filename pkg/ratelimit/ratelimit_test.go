@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("rejects invalid configuration", func(t *testing.T) {
+		cases := map[string]Config{
+			"unknown strategy": {Strategy: "leaky_bucket", Limit: 1, WindowSize: time.Minute},
+			"zero limit":       {Strategy: FixedWindow, Limit: 0, WindowSize: time.Minute},
+			"zero window":      {Strategy: TokenBucket, Limit: 1},
+		}
+
+		for name, config := range cases {
+			if _, err := NewFromConfig(config); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		}
+	})
+
+	t.Run("lists the known strategies", func(t *testing.T) {
+		_, err := New("leaky_bucket", 1, time.Minute)
+		if err == nil || !strings.Contains(err.Error(), TokenBucket) {
+			t.Errorf("expected the error to list the strategies got %v", err)
+		}
+	})
+
+	t.Run("calendar strategies need no window", func(t *testing.T) {
+		limiter, err := New(CalendarMonth, 100, 0, WithLocation(time.UTC), WithName("monthly"))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer limiter.Stop()
+
+		if limiter.Name() != "monthly" || limiter.StrategyName() != CalendarMonth {
+			t.Errorf("unexpected limiter %s %s", limiter.Name(), limiter.StrategyName())
+		}
+	})
+
+	t.Run("calendar time zone per identifier", func(t *testing.T) {
+		tokyo := time.FixedZone("JST", 9*60*60)
+		fakeClock := clock.NewFake(time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC))
+		limiter, err := New(CalendarDay, 1, 0, WithTimeProvider(fakeClock), WithLocationFor(func(identifier string) *time.Location {
+			if identifier == "tokyo-customer" {
+				return tokyo
+			}
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer limiter.Stop()
+
+		limiter.Decide("tokyo-customer")
+		limiter.Decide("utc-customer")
+		fakeClock.Advance(2 * time.Hour)
+
+		if !limiter.Decide("tokyo-customer").Allowed {
+			t.Error("a new day has started in tokyo")
+		}
+		if limiter.Decide("utc-customer").Allowed {
+			t.Error("the day has not ended in utc")
+		}
+	})
+
+	t.Run("applies options", func(t *testing.T) {
+		limiter, err := New(FixedWindow, 1, time.Minute, WithMaxKeys(1, DenyNewKeys), WithShadow(nil))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer limiter.Stop()
+
+		limiter.Decide("first")
+		if decision := limiter.Decide("second"); !decision.Allowed || !decision.Shadowed {
+			t.Errorf("expected a shadowed rejection got %+v", decision)
+		}
+	})
+}
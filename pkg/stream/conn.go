@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+)
+
+type conn struct {
+	net.Conn
+	ctx     context.Context
+	session *Session
+	scanner *bufio.Scanner
+	pending []byte
+}
+
+// NewConn limits the messages read from c, split by split or into lines by
+// default. Reads only return admitted messages. On Close the connection is
+// closed and Read returns the *CloseError.
+func NewConn(ctx context.Context, c net.Conn, session *Session, split bufio.SplitFunc) net.Conn {
+	if split == nil {
+		split = ScanLines
+	}
+	scanner := bufio.NewScanner(c)
+	scanner.Split(split)
+	return &conn{Conn: c, ctx: ctx, session: session, scanner: scanner}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if !c.scanner.Scan() {
+			if err := c.scanner.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+
+		message := c.scanner.Bytes()
+		err := c.session.Admit(c.ctx)
+		if errors.Is(err, ErrDropped) {
+			continue
+		}
+		var closeErr *CloseError
+		if errors.As(err, &closeErr) {
+			c.Conn.Close()
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.pending = bytes.Clone(message)
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// ScanLines splits newline terminated messages and keeps the newline, so
+// the limited connection reads the same bytes as the original one.
+func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
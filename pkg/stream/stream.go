@@ -0,0 +1,227 @@
+// Package stream limits messages on long-lived connections such as
+// WebSockets, where the HTTP middleware only sees the upgrade request.
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+// CloseCodePolicyViolation is the WebSocket close code used by default.
+const CloseCodePolicyViolation = 1008
+
+// ErrDropped is returned by Admit for messages that should be discarded.
+var ErrDropped = errors.New("stream: message dropped by rate limit")
+
+type Action int
+
+const (
+	// Drop discards messages over the limit and keeps the connection.
+	Drop Action = iota
+	// Delay holds messages until the limit allows them, waking up at the
+	// rejecting decision's RetryAt.
+	Delay
+	// Close ends the connection on the first message over the limit.
+	Close
+)
+
+func (a Action) String() string {
+	switch a {
+	case Delay:
+		return "delay"
+	case Close:
+		return "close"
+	default:
+		return "drop"
+	}
+}
+
+// CloseError asks the caller to close the connection, for WebSockets with a
+// close frame carrying Code and Reason.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("stream: closing connection with code %d: %s", e.Code, e.Reason)
+}
+
+// Limiter is satisfied by *ratelimiter.Ratelimiter, and by strategies
+// through ratelimiter.Adapt.
+type Limiter interface {
+	Allow(ctx context.Context, identifier string) (ratelimiter.Decision, error)
+}
+
+// Refunder is implemented by *ratelimiter.Ratelimiter and by strategies
+// adapted with ratelimiter.Adapt.
+type Refunder interface {
+	Refund(identifier string, n int) error
+}
+
+// MessageLimiter decides every message of a connection against a limit per
+// connection and a limit per user shared by all of the user's connections.
+// Either limit may be nil. A message the user limit rejects is refunded to
+// its connection if the connection limiter is a Refunder, so a throttled
+// user does not drain the budgets of their connections while delayed
+// messages are retried.
+type MessageLimiter struct {
+	Connection Limiter
+	User       Limiter
+
+	Action Action
+	// CloseCode defaults to CloseCodePolicyViolation.
+	CloseCode   int
+	CloseReason string
+	// MaxDelay bounds how long Delay holds a message before dropping it.
+	// Zero waits as long as the context allows.
+	MaxDelay time.Duration
+	// RetryInterval is how often a delayed message is retried when the
+	// decision has no RetryAt. Defaults to 100ms.
+	RetryInterval time.Duration
+	// Clock defaults to real time.
+	Clock clock.Clock
+
+	// OnViolation is called for every message over the limit, including the
+	// attempts of delayed messages.
+	OnViolation func(connectionID, userID string, action Action)
+}
+
+type Session struct {
+	limiter      *MessageLimiter
+	connectionID string
+	userID       string
+}
+
+// Session starts limiting one connection.
+func (l *MessageLimiter) Session(connectionID, userID string) *Session {
+	return &Session{limiter: l, connectionID: connectionID, userID: userID}
+}
+
+// Admit decides one message. It returns nil if the message should be
+// handled, ErrDropped if it should be discarded and a *CloseError if the
+// connection should be closed. Limiter errors are returned as is.
+func (s *Session) Admit(ctx context.Context) error {
+	l := s.limiter
+	var waited time.Duration
+
+	for {
+		decision, err := s.decide(ctx)
+		if err != nil || decision.Allowed {
+			return err
+		}
+		if l.OnViolation != nil {
+			l.OnViolation(s.connectionID, s.userID, l.Action)
+		}
+
+		switch l.Action {
+		case Close:
+			code := l.CloseCode
+			if code == 0 {
+				code = CloseCodePolicyViolation
+			}
+			return &CloseError{Code: code, Reason: l.CloseReason}
+		case Delay:
+			if l.MaxDelay > 0 && waited >= l.MaxDelay {
+				return ErrDropped
+			}
+			delay := s.delay(decision)
+			if l.MaxDelay > 0 {
+				delay = min(delay, l.MaxDelay-waited)
+			}
+			if err := s.wait(ctx, delay); err != nil {
+				return err
+			}
+			waited += delay
+		default:
+			return ErrDropped
+		}
+	}
+}
+
+// decide returns the decision that rejected the message, or an allowing one.
+func (s *Session) decide(ctx context.Context) (ratelimiter.Decision, error) {
+	l := s.limiter
+	connection := ratelimiter.Decision{Allowed: true}
+	if l.Connection != nil {
+		var err error
+		connection, err = l.Connection.Allow(ctx, s.connectionID)
+		if err != nil || !connection.Allowed {
+			return connection, err
+		}
+	}
+	if l.User == nil {
+		return connection, nil
+	}
+
+	user, err := l.User.Allow(ctx, s.userID)
+	if err != nil || !user.Allowed {
+		// Only tokens the connection's strategy took are given back.
+		refunder, ok := l.Connection.(Refunder)
+		if ok && connection.Source == ratelimiter.SourceStrategy && !connection.Shadowed {
+			refunder.Refund(s.connectionID, 1)
+		}
+	}
+	return user, err
+}
+
+// delay is how long a delayed message waits before it is decided again.
+func (s *Session) delay(decision ratelimiter.Decision) time.Duration {
+	if delay := decision.RetryAt.Sub(s.clock().Now()); delay > 0 {
+		return delay
+	}
+	return s.limiter.retryInterval()
+}
+
+func (s *Session) clock() clock.Clock {
+	if s.limiter.Clock != nil {
+		return s.limiter.Clock
+	}
+	return clock.Real{}
+}
+
+func (s *Session) wait(ctx context.Context, d time.Duration) error {
+	timer := s.clock().NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *MessageLimiter) retryInterval() time.Duration {
+	if l.RetryInterval > 0 {
+		return l.RetryInterval
+	}
+	return 100 * time.Millisecond
+}
+
+// ReadLoop reads messages until read fails and passes the admitted ones to
+// handle. It returns the first error of read, handle or the limiter, or the
+// *CloseError that ended the connection.
+func ReadLoop[T any](ctx context.Context, session *Session, read func() (T, error), handle func(T) error) error {
+	for {
+		message, err := read()
+		if err != nil {
+			return err
+		}
+
+		switch err := session.Admit(ctx); {
+		case errors.Is(err, ErrDropped):
+			continue
+		case err != nil:
+			return err
+		}
+
+		if err := handle(message); err != nil {
+			return err
+		}
+	}
+}
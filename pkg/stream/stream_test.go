@@ -0,0 +1,252 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/egedolmaci/my-ratelimiter/internal/ratelimiter"
+	"github.com/egedolmaci/my-ratelimiter/internal/strategies"
+	"github.com/egedolmaci/my-ratelimiter/pkg/clock"
+)
+
+type MockTimeProvider struct {
+	currentTime time.Time
+}
+
+func (m *MockTimeProvider) Now() time.Time {
+	return m.currentTime
+}
+
+func perMinute(limit int, tp strategies.TimeProvider) Limiter {
+	return ratelimiter.Adapt(strategies.NewFixedWindowStrategy(limit, time.Minute, tp))
+}
+
+// readAll feeds messages through ReadLoop and returns the handled ones.
+func readAll(session *Session, messages []string) ([]string, error) {
+	var handled []string
+	next := 0
+	err := ReadLoop(context.Background(), session,
+		func() (string, error) {
+			if next == len(messages) {
+				return "", io.EOF
+			}
+			next++
+			return messages[next-1], nil
+		},
+		func(message string) error {
+			handled = append(handled, message)
+			return nil
+		},
+	)
+	return handled, err
+}
+
+func TestMessageLimiter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	messages := []string{"a", "b", "c", "d"}
+
+	t.Run("drop discards messages over the connection limit", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		violations := 0
+		limiter := &MessageLimiter{
+			Connection:  perMinute(2, tp),
+			OnViolation: func(connectionID, userID string, action Action) { violations++ },
+		}
+
+		handled, err := readAll(limiter.Session("conn-1", "ege"), messages)
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("expected the loop to end with the reader got %v", err)
+		}
+		if len(handled) != 2 || violations != 2 {
+			t.Errorf("expected 2 handled and 2 dropped messages got %v and %d violations", handled, violations)
+		}
+	})
+
+	t.Run("the user limit is shared by the user's connections", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		limiter := &MessageLimiter{Connection: perMinute(10, tp), User: perMinute(3, tp)}
+
+		first, _ := readAll(limiter.Session("conn-1", "ege"), messages[:2])
+		second, _ := readAll(limiter.Session("conn-2", "ege"), messages[:2])
+		other, _ := readAll(limiter.Session("conn-3", "mert"), messages[:2])
+
+		if len(first)+len(second) != 3 {
+			t.Errorf("expected the user's connections to handle 3 messages together got %d", len(first)+len(second))
+		}
+		if len(other) != 2 {
+			t.Errorf("expected other users to be unaffected got %d", len(other))
+		}
+	})
+
+	t.Run("user rejections are refunded to the connection", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		connection := strategies.NewFixedWindowStrategy(3, time.Minute, tp)
+		defer connection.Stop()
+		limiter := &MessageLimiter{Connection: ratelimiter.Adapt(connection), User: perMinute(1, tp)}
+
+		handled, _ := readAll(limiter.Session("conn-1", "ege"), messages)
+		if len(handled) != 1 {
+			t.Errorf("expected the user limit to allow 1 message got %v", handled)
+		}
+		if _, remaining := connection.Peek("conn-1"); remaining != 2 {
+			t.Errorf("expected the rejected messages not to use the connection's budget got %d remaining", remaining)
+		}
+	})
+
+	t.Run("close ends the loop with the close code", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		limiter := &MessageLimiter{Connection: perMinute(1, tp), Action: Close, CloseReason: "too many messages"}
+
+		handled, err := readAll(limiter.Session("conn-1", "ege"), messages)
+		var closeErr *CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != CloseCodePolicyViolation || closeErr.Reason != "too many messages" {
+			t.Fatalf("expected a policy violation close got %v", err)
+		}
+		if len(handled) != 1 {
+			t.Errorf("expected 1 message before closing got %v", handled)
+		}
+
+		limiter.CloseCode = 4000
+		_, err = readAll(limiter.Session("conn-1", "ege"), messages)
+		if !errors.As(err, &closeErr) || closeErr.Code != 4000 {
+			t.Errorf("expected the configured close code got %v", err)
+		}
+	})
+
+	t.Run("delay waits for the limit", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		limiter := &MessageLimiter{
+			Connection:    perMinute(1, fakeClock),
+			Action:        Delay,
+			RetryInterval: 30 * time.Second,
+			Clock:         fakeClock,
+		}
+		session := limiter.Session("conn-1", "ege")
+
+		if err := session.Admit(context.Background()); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		admitted := make(chan error)
+		go func() { admitted <- session.Admit(context.Background()) }()
+
+		// The cleanup ticker and the retry timer.
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(30 * time.Second)
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(30 * time.Second)
+		if err := <-admitted; err != nil {
+			t.Errorf("expected the delayed message to be admitted in the next window got %v", err)
+		}
+	})
+
+	t.Run("delay sleeps until the limit resets", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		violations := 0
+		limiter := &MessageLimiter{
+			Connection:    perMinute(1, fakeClock),
+			Action:        Delay,
+			RetryInterval: time.Second,
+			Clock:         fakeClock,
+			OnViolation:   func(connectionID, userID string, action Action) { violations++ },
+		}
+		session := limiter.Session("conn-1", "ege")
+		session.Admit(context.Background())
+
+		admitted := make(chan error)
+		go func() { admitted <- session.Admit(context.Background()) }()
+
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(59 * time.Second)
+		fakeClock.Advance(time.Second)
+		if err := <-admitted; err != nil {
+			t.Errorf("expected the delayed message to be admitted at the reset got %v", err)
+		}
+		if violations != 1 {
+			t.Errorf("expected a single retry at the reset got %d violations", violations)
+		}
+	})
+
+	t.Run("delay drops after the max delay", func(t *testing.T) {
+		fakeClock := clock.NewFake(start)
+		limiter := &MessageLimiter{
+			Connection:    perMinute(1, fakeClock),
+			Action:        Delay,
+			RetryInterval: time.Second,
+			MaxDelay:      time.Second,
+			Clock:         fakeClock,
+		}
+		session := limiter.Session("conn-1", "ege")
+		session.Admit(context.Background())
+
+		admitted := make(chan error)
+		go func() { admitted <- session.Admit(context.Background()) }()
+
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(time.Second)
+		if err := <-admitted; !errors.Is(err, ErrDropped) {
+			t.Errorf("expected the message to be dropped got %v", err)
+		}
+	})
+
+	t.Run("delay stops with the context", func(t *testing.T) {
+		tp := &MockTimeProvider{currentTime: start}
+		limiter := &MessageLimiter{Connection: perMinute(1, tp), Action: Delay}
+		session := limiter.Session("conn-1", "ege")
+		session.Admit(context.Background())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := session.Admit(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the context error got %v", err)
+		}
+	})
+}
+
+func TestConn(t *testing.T) {
+	tp := &MockTimeProvider{currentTime: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+
+	t.Run("drops lines over the limit", func(t *testing.T) {
+		client, server := net.Pipe()
+		limiter := &MessageLimiter{Connection: perMinute(2, tp)}
+		limited := NewConn(context.Background(), server, limiter.Session("conn-1", "ege"), nil)
+
+		go func() {
+			client.Write([]byte("one\ntwo\nthree\n"))
+			client.Close()
+		}()
+
+		received, err := io.ReadAll(limited)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if string(received) != "one\ntwo\n" {
+			t.Errorf("expected the first two lines got %q", received)
+		}
+	})
+
+	t.Run("close closes the connection", func(t *testing.T) {
+		client, server := net.Pipe()
+		limiter := &MessageLimiter{Connection: perMinute(1, tp), Action: Close}
+		limited := NewConn(context.Background(), server, limiter.Session("conn-2", "ege"), nil)
+
+		go client.Write([]byte("one\ntwo\n"))
+
+		buf := make([]byte, 16)
+		if n, err := limited.Read(buf); err != nil || string(buf[:n]) != "one\n" {
+			t.Fatalf("expected the first line got %q, %v", buf[:n], err)
+		}
+
+		var closeErr *CloseError
+		if _, err := limited.Read(buf); !errors.As(err, &closeErr) {
+			t.Errorf("expected a close error got %v", err)
+		}
+		if _, err := client.Write([]byte("three\n")); err == nil {
+			t.Error("expected the underlying connection to be closed")
+		}
+	})
+}